@@ -4,25 +4,24 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"os/signal"
-	"runtime"
+	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/denistakeda/alerting/internal/agent"
 	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/delta"
 	"github.com/denistakeda/alerting/internal/grpcclient"
 	"github.com/denistakeda/alerting/internal/httpclient"
+	"github.com/denistakeda/alerting/internal/metric"
 	"github.com/denistakeda/alerting/internal/ports"
 	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/spool"
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog"
-	"github.com/shirou/gopsutil/v3/cpu"
-
-	"github.com/shirou/gopsutil/v3/mem"
 
-	"github.com/denistakeda/alerting/internal/metric"
 	"github.com/denistakeda/alerting/internal/storage"
 	"github.com/denistakeda/alerting/internal/storage/memstorage"
 )
@@ -48,31 +47,140 @@ func main() {
 
 	memStorage := memstorage.NewMemStorage(conf.Key, logService)
 
-	client, err := makeClient(conf)
+	senders, err := makeSenders(conf, logService)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("unable to initiate senders")
+	}
+	defer func() {
+		for _, snd := range senders {
+			if err := snd.client.Stop(); err != nil {
+				snd.logger.Error().Err(err).Msg("failed to stop client")
+			}
+		}
+	}()
+
+	rules, err := agent.NewRules(conf.Filter, logService)
 	if err != nil {
-		logger.Fatal().Err(err).Msg("unable to initiate a client")
+		logger.Fatal().Err(err).Msg("unable to initiate filter rules")
+	}
+
+	collectors := agent.NewRegistry(conf.PollInterval, conf.HostID, rules, memStorage, logService)
+	if err := agent.RegisterCollectors(collectors, conf.Collectors, logService); err != nil {
+		logger.Fatal().Err(err).Msg("unable to initiate collectors")
 	}
 
-	defer client.Stop()
+	go collectors.Run(context.Background())
+	for _, snd := range senders {
+		go sendStats(snd, conf.ReportInterval, memStorage)
+	}
 
-	go readStats(conf.PollInterval, memStorage, logger)
-	go sendStats(client, conf.ReportInterval, logger, memStorage)
+	var exporterChan <-chan error
+	if conf.ListenAddress != "" {
+		exporter := agent.NewExporter(conf.ListenAddress, conf.ListenToken, memStorage, logService)
+		exporterChan = exporter.Start()
+		defer func() {
+			if err := exporter.Stop(context.Background()); err != nil {
+				logger.Error().Err(err).Msg("failed to stop exporter")
+			}
+		}()
+	}
 
-	<-handleInterrupt()
+	select {
+	case <-handleInterrupt():
+	case err := <-exporterChan:
+		logger.Error().Err(err).Msg("exporter failed")
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := client.SendMetrics(memStorage.All(ctx)); err != nil {
-		logger.Fatal().Err(err).Msg("unable to send metrics before stop")
+	// Destinations are independent, so a slow one does not delay the others
+	metrics := memStorage.All(ctx)
+	var wg sync.WaitGroup
+	for _, snd := range senders {
+		wg.Add(1)
+		go func(snd *sender) {
+			defer wg.Done()
+			if err := snd.Send(metrics); err != nil {
+				snd.logger.Error().Err(err).Msg("unable to send metrics before stop")
+			}
+		}(snd)
+	}
+	wg.Wait()
+}
+
+func makeSenders(conf agentcfg.Config, logService *loggerservice.LoggerService) ([]*sender, error) {
+	dests := conf.AllDestinations()
+	senders := make([]*sender, 0, len(dests))
+	for _, dest := range dests {
+		client, err := makeClient(conf, dest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to initiate a client for %s", dest.Name)
+		}
+
+		sp, err := makeSpool(conf, dest, logService)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to initiate a spool for %s", dest.Name)
+		}
+
+		logger := logService.ComponentLogger("Agent")
+		if dest.Name != "" {
+			logger = logger.With().Str("destination", dest.Name).Logger()
+		}
+
+		// The HTTP client signs the whole batch, so the metrics are signed one by one only for gRPC
+		var key metric.Key
+		if dest.GRPCAddress != "" {
+			key = metric.Key{ID: dest.KeyID, Secret: dest.Key}
+		}
+		senders = append(senders, &sender{
+			client:  client,
+			spool:   sp,
+			tracker: delta.NewTracker(key),
+			stamp:   conf.ReplayProtection,
+			key:     key,
+			logger:  logger,
+		})
+	}
+
+	return senders, nil
+}
+
+func makeSpool(
+	conf agentcfg.Config,
+	dest agentcfg.DestinationConfig,
+	logService *loggerservice.LoggerService,
+) (*spool.Spool, error) {
+	if conf.SpoolDir == "" {
+		return nil, nil
 	}
+	// Every destination has its own queue
+	dir := filepath.Join(conf.SpoolDir, dest.Name)
+	return spool.New(dir, conf.SpoolMaxSize, spool.Policy(conf.SpoolPolicy), logService)
 }
 
-func makeClient(conf agentcfg.Config) (ports.Client, error) {
-	if conf.GRPCAddress == "" {
-		return httpclient.New(conf.RateLimit, conf.CryptoKey, conf.Address)
+func makeClient(conf agentcfg.Config, dest agentcfg.DestinationConfig) (ports.Client, error) {
+	if dest.GRPCAddress == "" {
+		return httpclient.New(httpclient.Params{
+			RateLimit:        dest.RateLimit,
+			Cert:             dest.CryptoKey,
+			Address:          dest.Address,
+			EncryptionKey:    dest.EncryptionKey,
+			RealIP:           conf.RealIP,
+			Token:            dest.Token,
+			Key:              metric.Key{ID: dest.KeyID, Secret: dest.Key},
+			RetryPolicy:      conf.RetryPolicy(),
+			RetryStatusCodes: conf.RetryStatusCodes,
+		})
 	} else {
-		return grpcclient.NewGRPCClient(conf.GRPCAddress)
+		return grpcclient.NewGRPCClient(grpcclient.Params{
+			Address:     dest.GRPCAddress,
+			Cert:        dest.GRPCTLSCA,
+			RealIP:      conf.RealIP,
+			Token:       dest.Token,
+			RetryPolicy: conf.RetryPolicy(),
+			RetryCodes:  conf.RetryGRPCStatusCodes(),
+		})
 	}
 }
 
@@ -89,104 +197,19 @@ func handleInterrupt() <-chan os.Signal {
 	return out
 }
 
-func readStats(pollInterval time.Duration, store storage.Storage, logger zerolog.Logger) {
-	pollTicker := time.NewTicker(pollInterval)
-
-	for range pollTicker.C {
-		go func() {
-			if err := registerRuntimeMetrics(store, logger); err != nil {
-				logger.Error().Err(err).Msg("failed to register runtime metrics")
-			}
-		}()
-
-		go func() {
-			if err := registerGoOpsMetrics(store, logger); err != nil {
-				logger.Error().Err(err).Msg("failed to register goops metrics")
-			}
-		}()
-	}
-}
-
 func sendStats(
-	client ports.Client,
+	snd *sender,
 	reportInterval time.Duration,
-	logger zerolog.Logger,
 	store storage.Storage,
 ) {
 	// Task publisher
 	reportTicker := time.NewTicker(reportInterval)
 	for range reportTicker.C {
 		metrics := store.All(context.Background())
-		if err := client.SendMetrics(metrics); err != nil {
-			logger.Error().Err(err).Msg("failed to send metrics")
+		if err := snd.Send(metrics); err != nil {
+			snd.logger.Error().Err(err).Msg("failed to send metrics")
 			continue
 		}
-		logger.Info().Msgf("successfully sent %d metrics", len(metrics))
-	}
-}
-
-func registerRuntimeMetrics(store storage.Storage, logger zerolog.Logger) error {
-	memStats := &runtime.MemStats{}
-	runtime.ReadMemStats(memStats)
-
-	registerMetric(store, logger, metric.NewGauge("Alloc", float64(memStats.Alloc)))
-	registerMetric(store, logger, metric.NewGauge("BuckHashSys", float64(memStats.BuckHashSys)))
-	registerMetric(store, logger, metric.NewGauge("Frees", float64(memStats.Frees)))
-	registerMetric(store, logger, metric.NewGauge("GCCPUFraction", float64(memStats.GCCPUFraction)))
-	registerMetric(store, logger, metric.NewGauge("GCSys", float64(memStats.GCSys)))
-	registerMetric(store, logger, metric.NewGauge("HeapAlloc", float64(memStats.HeapAlloc)))
-	registerMetric(store, logger, metric.NewGauge("HeapIdle", float64(memStats.HeapIdle)))
-	registerMetric(store, logger, metric.NewGauge("HeapInuse", float64(memStats.HeapInuse)))
-	registerMetric(store, logger, metric.NewGauge("HeapObjects", float64(memStats.HeapObjects)))
-	registerMetric(store, logger, metric.NewGauge("HeapReleased", float64(memStats.HeapReleased)))
-	registerMetric(store, logger, metric.NewGauge("HeapSys", float64(memStats.HeapSys)))
-	registerMetric(store, logger, metric.NewGauge("LastGC", float64(memStats.LastGC)))
-	registerMetric(store, logger, metric.NewGauge("Lookups", float64(memStats.Lookups)))
-	registerMetric(store, logger, metric.NewGauge("MCacheInuse", float64(memStats.MCacheInuse)))
-	registerMetric(store, logger, metric.NewGauge("MCacheSys", float64(memStats.MCacheSys)))
-	registerMetric(store, logger, metric.NewGauge("MSpanInuse", float64(memStats.MSpanInuse)))
-	registerMetric(store, logger, metric.NewGauge("MSpanSys", float64(memStats.MSpanSys)))
-	registerMetric(store, logger, metric.NewGauge("Mallocs", float64(memStats.Mallocs)))
-	registerMetric(store, logger, metric.NewGauge("NextGC", float64(memStats.NextGC)))
-	registerMetric(store, logger, metric.NewGauge("NumForcedGC", float64(memStats.NumForcedGC)))
-	registerMetric(store, logger, metric.NewGauge("NumGC", float64(memStats.NumGC)))
-	registerMetric(store, logger, metric.NewGauge("OtherSys", float64(memStats.OtherSys)))
-	registerMetric(store, logger, metric.NewGauge("PauseTotalNs", float64(memStats.PauseTotalNs)))
-	registerMetric(store, logger, metric.NewGauge("StackInuse", float64(memStats.StackInuse)))
-	registerMetric(store, logger, metric.NewGauge("StackSys", float64(memStats.StackSys)))
-	registerMetric(store, logger, metric.NewGauge("Sys", float64(memStats.Sys)))
-	registerMetric(store, logger, metric.NewGauge("TotalAlloc", float64(memStats.TotalAlloc)))
-
-	registerMetric(store, logger, metric.NewCounter("PollCount", 1))
-	registerMetric(store, logger, metric.NewGauge("RandomValue", float64(rand.Int())))
-
-	return nil
-}
-
-func registerGoOpsMetrics(store storage.Storage, logger zerolog.Logger) error {
-	gopsutilMemory, err := mem.VirtualMemory()
-	if err != nil {
-		return errors.Wrap(err, "failed to read virtual memory stats")
-	}
-
-	registerMetric(store, logger, metric.NewGauge("TotalMemory", float64(gopsutilMemory.Total)))
-	registerMetric(store, logger, metric.NewGauge("FreeMemory", float64(gopsutilMemory.Free)))
-
-	cpus, err := cpu.Percent(0, true)
-	if err != nil {
-		return errors.Wrap(err, "failed to read get the number of cores")
-	}
-
-	for idx, cpuUsage := range cpus {
-		registerMetric(store, logger, metric.NewGauge(fmt.Sprintf("CPUutilization%d", idx), cpuUsage))
-	}
-
-	return nil
-}
-
-func registerMetric(store storage.Storage, logger zerolog.Logger, m *metric.Metric) {
-	_, err := store.Update(context.Background(), m)
-	if err != nil {
-		logger.Error().Err(err).Msgf("Failed to update metric %v\n", m)
+		snd.logger.Info().Msgf("successfully delivered %d metrics", len(metrics))
 	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/delta"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/ports"
+	"github.com/denistakeda/alerting/internal/spool"
+)
+
+// sender delivers metrics to the server. Counters are sent as deltas since
+// the last delivery, the batches which failed to be sent are spooled if the
+// spool is configured.
+//
+// If stamp is set, every batch is stamped with the time of sending, so the
+// spooled batches are not rejected by the replay protection of the server.
+type sender struct {
+	client  ports.Client
+	spool   *spool.Spool
+	tracker *delta.Tracker
+	stamp   bool
+	key     metric.Key
+	logger  zerolog.Logger
+}
+
+// Send delivers the metrics. The batch is considered delivered when it is
+// either sent or spooled.
+func (s *sender) Send(metrics []*metric.Metric) error {
+	err := s.tracker.Send(metrics, s.deliver)
+	if errors.Is(err, ports.ErrSeriesLimit) {
+		// The rest of the batch was stored, the rejected counters are sent again with the next batch
+		s.logger.Warn().Err(err).Msg("server rejected new series")
+		return nil
+	}
+	return err
+}
+
+func (s *sender) deliver(metrics []*metric.Metric) error {
+	if s.spool == nil {
+		return s.send(metrics)
+	}
+
+	// Keep the order: nothing new is sent until the spool is drained
+	err := s.spool.Replay(s.sendSpooled)
+	if err == nil {
+		err = s.send(metrics)
+	}
+	// The rest of the batch was stored, so it is not spooled
+	if err != nil && !errors.Is(err, ports.ErrSeriesLimit) {
+		if spoolErr := s.spool.Push(metrics); spoolErr != nil {
+			return errors.Wrapf(err, "failed to spool metrics: %v", spoolErr)
+		}
+		s.logger.Warn().Err(err).Msgf("metrics were spooled, %d batches are pending", s.spool.Len())
+		return nil
+	}
+
+	return err
+}
+
+// sendSpooled sends a spooled batch. Its counters were acknowledged when it was
+// spooled, so the series rejected by the server are dropped.
+func (s *sender) sendSpooled(metrics []*metric.Metric) error {
+	err := s.send(metrics)
+	if errors.Is(err, ports.ErrSeriesLimit) {
+		s.logger.Warn().Err(err).Msg("server rejected new series of a spooled batch")
+		return nil
+	}
+	return err
+}
+
+func (s *sender) send(metrics []*metric.Metric) error {
+	if s.stamp {
+		stamped, err := metric.Stamp(metrics, s.key, time.Now())
+		if err != nil {
+			return err
+		}
+		metrics = stamped
+	}
+
+	return s.client.SendMetrics(metrics)
+}
@@ -0,0 +1,34 @@
+package main
+
+// Keygen generates an RSA key pair for the payload encryption between agent and server.
+// The server is configured with the private key, the agent with the public one:
+//   keygen -private server.key -public server.pub
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/denistakeda/alerting/internal/encryption"
+)
+
+func main() {
+	bits := flag.Int("bits", 4096, "Size of the key in bits")
+	privatePath := flag.String("private", "private.pem", "Where to write the private key")
+	publicPath := flag.String("public", "public.pem", "Where to write the public key")
+	flag.Parse()
+
+	privatePEM, publicPEM, err := encryption.GenerateKeyPair(*bits)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*privatePath, privatePEM, 0600); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*publicPath, publicPEM, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("private key is written to %s, public key is written to %s", *privatePath, *publicPath)
+}
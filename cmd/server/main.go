@@ -10,27 +10,35 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"log"
-	"net"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/denistakeda/alerting/docs"
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
 	servercfg "github.com/denistakeda/alerting/internal/config/server"
+	"github.com/denistakeda/alerting/internal/encryption"
 	"github.com/denistakeda/alerting/internal/grpcserver"
 	"github.com/denistakeda/alerting/internal/handler"
 	"github.com/denistakeda/alerting/internal/middleware"
+	"github.com/denistakeda/alerting/internal/ratelimit"
+	"github.com/denistakeda/alerting/internal/replay"
+	"github.com/denistakeda/alerting/internal/scraper"
 	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/services/shutdownservice"
 	s "github.com/denistakeda/alerting/internal/storage"
 	"github.com/denistakeda/alerting/internal/storage/dbstorage"
 	"github.com/denistakeda/alerting/internal/storage/filestorage"
+	"github.com/denistakeda/alerting/internal/storage/limitstorage"
 	"github.com/denistakeda/alerting/internal/storage/memstorage"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/logger"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -52,31 +60,119 @@ func main() {
 
 	logService := loggerservice.New()
 
-	storage, err := getStorage(conf, logService)
+	baseStorage, err := getStorage(conf, logService)
 	if err != nil {
 		log.Fatal(err)
 	}
+	tokens, ok := baseStorage.(s.TokenStorage)
+	if !ok {
+		log.Fatal("storage does not support tokens")
+	}
+	auditStorage, ok := baseStorage.(s.AuditStorage)
+	if !ok {
+		log.Fatal("storage does not support audit log")
+	}
+	auditLog := audit.NewLog(auditStorage, logService)
+	// The series are always counted, so the cardinality is reported even without limits
+	storage := limitstorage.NewLimitStorage(context.Background(), baseStorage, limitstorage.Limits{
+		Max:      conf.MaxSeries,
+		Prefixes: conf.SeriesLimits,
+	}, logService)
+
+	proxies, err := middleware.ParseNetworks(conf.TrustedProxies)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "invalid trusted proxies"))
+	}
+
+	// The peer address is used if there is nothing better. The address can't be spoofed
+	// to pass the access policy or evade the limits, only the trusted proxies may report it.
+	clientIP := middleware.ClientIPResolver{TrustedProxies: proxies, PeerFallback: true, ProxiedRealIP: true}
+
+	access, err := newAccessPolicy(conf, clientIP)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var limiter *ratelimit.Limiter
+	if conf.IngestRequestRate > 0 || conf.IngestMetricRate > 0 {
+		limiter = ratelimit.New(ratelimit.Limits{
+			RequestRate:  conf.IngestRequestRate,
+			RequestBurst: conf.IngestRequestBurst,
+			MetricRate:   conf.IngestMetricRate,
+			MetricBurst:  conf.IngestMetricBurst,
+		})
+	}
+
+	var authenticator *auth.Authenticator
+	if conf.AdminToken != "" {
+		authenticator = auth.NewAuthenticator(tokens, conf.AdminToken)
+	}
+
+	keys, err := conf.Keyring()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var replayGuard *replay.Guard
+	if conf.ReplayWindow > 0 {
+		replayGuard = replay.New(conf.ReplayWindow, conf.ReplayCacheSize)
+	}
+
+	var decryption *rsa.PrivateKey
+	if conf.EncryptionKey != "" {
+		decryption, err = encryption.LoadPrivateKey(conf.EncryptionKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r := newRouter()
 
-	r := newRouter(conf.TrustedSubnet)
 	apiHandler := handler.New(handler.Params{
 		Addr:       conf.Address,
-		HashKey:    conf.Key,
+		Keys:       keys,
+		Replay:     replayGuard,
+		Limiter:    limiter,
+		ClientIP:   clientIP,
 		Cert:       conf.Certificate,
 		PrivateKey: conf.CryptoKey,
+		Decryption: decryption,
+		Access:     access,
+		Auth:       authenticator,
+		Tokens:     tokens,
+		Series:     storage,
+		Audit:      auditLog,
 
 		Engine:     r,
 		Storage:    storage,
 		LogService: logService,
 	})
 	serverChan := apiHandler.Start()
-	defer apiHandler.Stop()
 
-	grpcServer := grpcserver.NewGRPCServer(logService, storage, conf.GRPCAddress)
+	grpcServer := grpcserver.NewGRPCServer(grpcserver.Params{
+		Address:    conf.GRPCAddress,
+		Access:     access,
+		Auth:       authenticator,
+		Keys:       keys,
+		Replay:     replayGuard,
+		Limiter:    limiter,
+		ClientIP:   clientIP,
+		Audit:      auditLog,
+		Storage:    storage,
+		LogService: logService,
+	})
 	grpcServerChan := grpcServer.Start()
-	defer grpcServer.Stop()
+
+	metricsScraper := scraper.New(conf.ScrapeTargets, conf.ScrapeInterval, conf.ScrapeToken, keys, storage, logService)
+	metricsScraper.Start()
 
 	docs.SwaggerInfo.BasePath = "/"
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	r.GET(
+		"/swagger/*any",
+		access.Middleware(middleware.GroupAdmin),
+		middleware.Authenticate(authenticator, middleware.GroupAdmin),
+		ginSwagger.WrapHandler(swaggerFiles.Handler),
+	)
 
 	r.LoadHTMLGlob("internal/templates/*")
 	interruptChan := handleInterrupt()
@@ -90,10 +186,25 @@ func main() {
 	}
 
 	// Clean up before finishing
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	storage.Close(ctx)
+	shutdown := shutdownservice.New(conf.ShutdownTimeout, logService)
+	shutdown.Stage(shutdownservice.Step{
+		Name: "GRPC health",
+		Stop: func(_ context.Context) error {
+			grpcServer.SetNotServing()
+			return nil
+		},
+	})
+	shutdown.Stage(
+		shutdownservice.Step{Name: "HTTP server", Stop: apiHandler.Stop},
+		shutdownservice.Step{Name: "GRPC server", Stop: grpcServer.Stop},
+		shutdownservice.Step{Name: "Scraper", Stop: metricsScraper.Stop},
+	)
+	// The storage is flushed even if the servers took the whole shutdown timeout to drain
+	shutdown.StageWithTimeout(conf.StorageCloseTimeout, shutdownservice.Step{Name: "Storage", Stop: storage.Close})
+
+	if err := shutdown.Shutdown(); err != nil {
+		log.Println(err)
+	}
 }
 
 func printInfo() {
@@ -102,7 +213,7 @@ func printInfo() {
 	fmt.Printf("Build commit: %s\n", buildCommit)
 }
 
-func newRouter(trustedSubnet string) *gin.Engine {
+func newRouter() *gin.Engine {
 	r := gin.New()
 
 	r.RedirectTrailingSlash = false
@@ -110,16 +221,20 @@ func newRouter(trustedSubnet string) *gin.Engine {
 	r.Use(gin.Recovery())
 	r.Use(logger.SetLogger())
 
-	if trustedSubnet != "" {
-		_, subnet, err := net.ParseCIDR(trustedSubnet)
-		if err != nil {
-			log.Fatal("'TrustedSubnet' is incorrect")
-		}
+	return r
+}
 
-		r.Use(middleware.CheckSubnetMiddleware(subnet))
+// newAccessPolicy returns nil if no networks are configured, so everything is allowed.
+func newAccessPolicy(conf servercfg.Config, resolver middleware.ClientIPResolver) (*middleware.AccessPolicy, error) {
+	subnets := append([]string(nil), conf.TrustedSubnets...)
+	if conf.TrustedSubnet != "" {
+		subnets = append(subnets, conf.TrustedSubnet)
+	}
+	if len(subnets) == 0 && len(conf.AccessPolicy) == 0 {
+		return nil, nil
 	}
 
-	return r
+	return middleware.NewAccessPolicy(subnets, conf.AccessPolicy, resolver)
 }
 
 func handleInterrupt() <-chan os.Signal {
@@ -2,16 +2,27 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
+	servercfg "github.com/denistakeda/alerting/internal/config/server"
 	"github.com/denistakeda/alerting/internal/handler"
+	"github.com/denistakeda/alerting/internal/middleware"
+	"github.com/denistakeda/alerting/internal/replay"
 	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage"
+	"github.com/denistakeda/alerting/internal/storage/memstorage"
 	"github.com/denistakeda/alerting/mocks"
 
 	"github.com/stretchr/testify/assert"
@@ -78,10 +89,9 @@ func Test_updateMetric(t *testing.T) {
 			s := mocks.NewMockStorage(ctrl)
 			s.EXPECT().Update(gomock.Any(), tt.met).Return(tt.met, nil).AnyTimes()
 
-			router := newRouter("")
+			router := newRouter()
 			apiHandler := handler.New(handler.Params{
 				Addr:       "",
-				HashKey:    "",
 				Cert:       "",
 				PrivateKey: "",
 				Engine:     router,
@@ -90,7 +100,7 @@ func Test_updateMetric(t *testing.T) {
 			})
 
 			apiHandler.Start()
-			defer apiHandler.Stop()
+			defer apiHandler.Stop(context.Background())
 
 			w := httptest.NewRecorder()
 			req, _ := http.NewRequest("POST", tt.request, nil)
@@ -175,10 +185,9 @@ func Test_getMetric(t *testing.T) {
 				Return(tt.storageMock.retMetric, tt.storageMock.retOk).
 				AnyTimes()
 
-			router := newRouter("")
+			router := newRouter()
 			apiHandler := handler.New(handler.Params{
 				Addr:       "",
-				HashKey:    "",
 				Cert:       "",
 				PrivateKey: "",
 				Engine:     router,
@@ -187,7 +196,7 @@ func Test_getMetric(t *testing.T) {
 			})
 
 			apiHandler.Start()
-			defer apiHandler.Stop()
+			defer apiHandler.Stop(context.Background())
 
 			w := httptest.NewRecorder()
 			req, _ := http.NewRequest("GET", tt.request, nil)
@@ -203,6 +212,7 @@ func Test_update(t *testing.T) {
 
 	g1 := metric.NewGauge("gauge1", 3.14)
 	g2 := metric.NewGauge("gauge2", 5.18)
+	g5 := metric.NewGauge("gauge5", 1)
 	c3 := metric.NewCounter("counter1", 7)
 	c4 := metric.NewCounter(c3.Name(), 14)
 
@@ -273,6 +283,19 @@ func Test_update(t *testing.T) {
 				body: marshal(t, metric.NewCounter(c3.Name(), 14)),
 			},
 		},
+		{
+			name:        "new series beyond the limit",
+			requestBody: marshal(t, g5),
+			storageMock: storageMock{
+				reqMetric: g5,
+				resMetric: nil,
+				resError:  &storage.SeriesLimitError{Rejected: []storage.Series{{Type: metric.Gauge, ID: g5.ID}}},
+			},
+			want: want{
+				code: http.StatusUnprocessableEntity,
+				body: []byte(`{"error":"series limit exceeded","rejected":[{"type":"gauge","id":"gauge5"}]}`),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -286,10 +309,9 @@ func Test_update(t *testing.T) {
 				Return(tt.storageMock.resMetric, tt.storageMock.resError).
 				AnyTimes()
 
-			router := newRouter("")
+			router := newRouter()
 			apiHandler := handler.New(handler.Params{
 				Addr:       "",
-				HashKey:    "",
 				Cert:       "",
 				PrivateKey: "",
 				Engine:     router,
@@ -298,7 +320,7 @@ func Test_update(t *testing.T) {
 			})
 
 			apiHandler.Start()
-			defer apiHandler.Stop()
+			defer apiHandler.Stop(context.Background())
 
 			w := httptest.NewRecorder()
 			req, _ := http.NewRequest("POST", "/update/", bytes.NewBuffer(tt.requestBody))
@@ -311,6 +333,398 @@ func Test_update(t *testing.T) {
 	}
 }
 
+func Test_replay(t *testing.T) {
+	stamp := func(metrics ...*metric.Metric) []*metric.Metric {
+		stamped, err := metric.Stamp(metrics, metric.Key{}, time.Now())
+		require.NoError(t, err)
+		return stamped
+	}
+	post := func(router http.Handler, url string, body []byte) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	newReplayRouter := func(s storage.Storage, size int) http.Handler {
+		router := newRouter()
+		handler.New(handler.Params{
+			Replay:     replay.New(time.Minute, size),
+			Engine:     router,
+			Storage:    s,
+			LogService: loggerservice.New(),
+		})
+		return router
+	}
+
+	t.Run("batch with an invalid metric is accepted when fixed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := mocks.NewMockStorage(ctrl)
+		s.EXPECT().UpdateAll(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		router := newReplayRouter(s, 100)
+
+		batch := stamp(metric.NewCounter("PollCount", 1), metric.NewGauge("Alloc", 1))
+		invalid := *batch[1]
+		invalid.MType = "histogram"
+		code := post(router, "/updates/", marshal(t, []*metric.Metric{batch[0], &invalid}))
+		require.Equal(t, http.StatusBadRequest, code)
+
+		assert.Equal(t, http.StatusOK, post(router, "/updates/", marshal(t, batch)))
+		assert.Equal(t, http.StatusBadRequest, post(router, "/updates/", marshal(t, batch)))
+	})
+
+	t.Run("batch failed to be stored is accepted when resent", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := mocks.NewMockStorage(ctrl)
+		gomock.InOrder(
+			s.EXPECT().UpdateAll(gomock.Any(), gomock.Any()).Return(errors.New("storage is down")),
+			s.EXPECT().UpdateAll(gomock.Any(), gomock.Any()).Return(nil),
+		)
+		router := newReplayRouter(s, 100)
+
+		body := marshal(t, stamp(metric.NewCounter("PollCount", 1)))
+		require.Equal(t, http.StatusInternalServerError, post(router, "/updates/", body))
+		assert.Equal(t, http.StatusOK, post(router, "/updates/", body))
+		assert.Equal(t, http.StatusBadRequest, post(router, "/updates/", body))
+	})
+
+	t.Run("metric failed to be stored is accepted when resent", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := mocks.NewMockStorage(ctrl)
+		m := metric.NewGauge("Alloc", 1)
+		gomock.InOrder(
+			s.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil, errors.New("storage is down")),
+			s.EXPECT().Update(gomock.Any(), gomock.Any()).Return(m, nil),
+		)
+		router := newReplayRouter(s, 100)
+
+		body := marshal(t, stamp(m)[0])
+		require.Equal(t, http.StatusBadRequest, post(router, "/update/", body))
+		assert.Equal(t, http.StatusOK, post(router, "/update/", body))
+		assert.Equal(t, http.StatusBadRequest, post(router, "/update/", body))
+	})
+
+	t.Run("metric of the URI is rejected", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		router := newReplayRouter(mocks.NewMockStorage(ctrl), 100)
+
+		assert.Equal(t, http.StatusBadRequest, post(router, "/update/counter/PollCount/1", nil))
+	})
+
+	t.Run("batch is rejected while the nonces can't be remembered", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := mocks.NewMockStorage(ctrl)
+		s.EXPECT().UpdateAll(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		router := newReplayRouter(s, 1)
+
+		require.Equal(t, http.StatusOK, post(router, "/updates/", marshal(t, stamp(metric.NewCounter("PollCount", 1)))))
+		assert.Equal(t, http.StatusServiceUnavailable, post(router, "/updates/", marshal(t, stamp(metric.NewCounter("PollCount", 1)))))
+	})
+}
+
+func Test_batchSignature(t *testing.T) {
+	const secret = "secret"
+
+	badHash := metric.NewGauge("Alloc", 1)
+	badHash.Hash = "bad"
+	signed := marshal(t, []*metric.Metric{metric.NewCounter("PollCount", 1), badHash})
+	tampered := bytes.Replace(signed, []byte(`"delta":1`), []byte(`"delta":100`), 1)
+	require.NotEqual(t, signed, tampered)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		wantCode  int
+	}{
+		{
+			name:      "signed batch with missing and bad hashes of the metrics",
+			body:      signed,
+			signature: metric.BatchHash(signed, secret),
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "tampered batch",
+			body:      tampered,
+			signature: metric.BatchHash(signed, secret),
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "batch signed with another key",
+			body:      signed,
+			signature: metric.BatchHash(signed, "another"),
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:     "unsigned batch with missing and bad hashes of the metrics",
+			body:     signed,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := metric.NewKeyring(metric.Key{Secret: secret})
+			require.NoError(t, err)
+
+			ctrl := gomock.NewController(t)
+			s := mocks.NewMockStorage(ctrl)
+			s.EXPECT().UpdateAll(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+			router := newRouter()
+			handler.New(handler.Params{
+				Keys:       keys,
+				Engine:     router,
+				Storage:    s,
+				LogService: loggerservice.New(),
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/updates/", bytes.NewBuffer(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.signature != "" {
+				req.Header.Set(metric.BatchHashHeader, tt.signature)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func Test_tokenRoutes(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	tests := []struct {
+		name     string
+		auth     bool
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "authentication is disabled",
+			auth:     false,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "no token",
+			auth:     true,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "admin token",
+			auth:     true,
+			token:    adminToken,
+			wantCode: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logService := loggerservice.New()
+			tokens := memstorage.NewMemStorage("", logService)
+
+			var authenticator *auth.Authenticator
+			if tt.auth {
+				authenticator = auth.NewAuthenticator(tokens, adminToken)
+			}
+
+			router := newRouter()
+			handler.New(handler.Params{
+				Auth:       authenticator,
+				Tokens:     tokens,
+				Engine:     router,
+				Storage:    tokens,
+				LogService: logService,
+			})
+
+			w := httptest.NewRecorder()
+			body := marshal(t, map[string]any{"name": "agent", "scopes": []string{"write"}})
+			req, _ := http.NewRequest(http.MethodPost, "/admin/tokens", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func Test_auditLog(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	ctx := context.Background()
+	logService := loggerservice.New()
+	store := memstorage.NewMemStorage("", logService)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, entry := range []audit.Entry{
+		{Actor: "admin", Action: "token.create", Target: "t1"},
+		{Actor: "admin", Action: "token.revoke", Target: "t1"},
+		{Actor: "ops", Action: "token.create", Target: "t2"},
+	} {
+		entry := entry
+		entry.Time = start.Add(time.Duration(i) * time.Minute)
+		entry.Outcome = audit.OutcomeSuccess
+		require.NoError(t, store.AppendAudit(ctx, &entry))
+	}
+
+	router := newRouter()
+	handler.New(handler.Params{
+		Auth:       auth.NewAuthenticator(store, adminToken),
+		Tokens:     store,
+		Audit:      audit.NewLog(store, logService),
+		ClientIP:   middleware.ClientIPResolver{PeerFallback: true, ProxiedRealIP: true},
+		Engine:     router,
+		Storage:    store,
+		LogService: logService,
+	})
+	get := func(query string) (int, []string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/audit"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		router.ServeHTTP(w, req)
+
+		var entries []audit.Entry
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		}
+		targets := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			targets = append(targets, entry.Action+" "+entry.Target)
+		}
+		return w.Code, targets
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{
+			name:     "all entries, the newest first",
+			wantCode: http.StatusOK,
+			want:     []string{"token.create t2", "token.revoke t1", "token.create t1"},
+		},
+		{
+			name:     "by action",
+			query:    "?action=token.create",
+			wantCode: http.StatusOK,
+			want:     []string{"token.create t2", "token.create t1"},
+		},
+		{
+			name:     "by actor",
+			query:    "?actor=ops",
+			wantCode: http.StatusOK,
+			want:     []string{"token.create t2"},
+		},
+		{
+			name:     "by time",
+			query:    "?since=2024-01-01T00:01:00Z&until=2024-01-01T00:02:00Z",
+			wantCode: http.StatusOK,
+			want:     []string{"token.revoke t1"},
+		},
+		{
+			name:     "limit",
+			query:    "?limit=2",
+			wantCode: http.StatusOK,
+			want:     []string{"token.create t2", "token.revoke t1"},
+		},
+		{
+			name:     "invalid since",
+			query:    "?since=yesterday",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "negative limit",
+			query:    "?limit=-1",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, got := get(tt.query)
+			assert.Equal(t, tt.wantCode, code)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+
+	t.Run("address reported by an untrusted client is not recorded", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := marshal(t, map[string]any{"name": "agent", "scopes": []string{"write"}})
+		req, _ := http.NewRequest(http.MethodPost, "/admin/tokens", bytes.NewBuffer(body))
+		req.RemoteAddr = "192.0.2.1:5000"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		entries, err := store.AuditEntries(ctx, audit.Filter{Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "192.0.2.1", entries[0].IP)
+	})
+}
+
+func Test_newAccessPolicy(t *testing.T) {
+	proxies, err := middleware.ParseNetworks([]string{"192.0.2.10"})
+	require.NoError(t, err)
+	resolver := middleware.ClientIPResolver{TrustedProxies: proxies, PeerFallback: true, ProxiedRealIP: true}
+
+	subnets := make([]string, 1, 2)
+	subnets[0] = "172.16.0.0/12"
+	conf := servercfg.Config{TrustedSubnets: subnets, TrustedSubnet: "10.0.0.0/8"}
+	policy, err := newAccessPolicy(conf, resolver)
+	require.NoError(t, err)
+	assert.Empty(t, subnets[:2][1], "the configuration is not modified")
+
+	router := newRouter()
+	router.GET("/admin/tokens", policy.Middleware(middleware.GroupAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		wantCode   int
+	}{
+		{
+			name:       "peer in the trusted subnet",
+			remoteAddr: "10.0.0.5:5000",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "spoofed address from an untrusted peer",
+			remoteAddr: "198.51.100.1:5000",
+			realIP:     "10.0.0.5",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "address reported by a trusted proxy",
+			remoteAddr: "192.0.2.10:5000",
+			realIP:     "10.0.0.5",
+			wantCode:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/admin/tokens", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
 func marshal(t *testing.T, v any) []byte {
 	res, err := json.Marshal(v)
 	require.NoError(t, err)
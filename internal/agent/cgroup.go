@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// unlimited is the value of cgroup limits which are not set, it is reported
+// as zero, so a limit removed at runtime does not stay on the server.
+const unlimited = "max"
+
+// cpuStatCounters maps the fields of cpu.stat to the metric names.
+var cpuStatCounters = map[string]string{
+	"usage_usec":     "CgroupCPUUsageUsec",
+	"user_usec":      "CgroupCPUUserUsec",
+	"system_usec":    "CgroupCPUSystemUsec",
+	"nr_periods":     "CgroupCPUPeriods",
+	"nr_throttled":   "CgroupCPUThrottled",
+	"throttled_usec": "CgroupCPUThrottledUsec",
+}
+
+// ioStatCounters maps the fields of io.stat to the metric names.
+var ioStatCounters = map[string]string{
+	"rbytes": "CgroupIOReadBytes",
+	"wbytes": "CgroupIOWriteBytes",
+	"rios":   "CgroupIOReadOps",
+	"wios":   "CgroupIOWriteOps",
+}
+
+// CgroupCollector collects the resource usage of the cgroup v2 the agent runs in.
+type CgroupCollector struct {
+	root     string
+	counters *cumulativeCounters
+}
+
+var _ Collector = (*CgroupCollector)(nil)
+
+// NewCgroupCollector instantiates a new CgroupCollector.
+func NewCgroupCollector(conf agentcfg.CgroupCollectorConfig) *CgroupCollector {
+	return &CgroupCollector{
+		root:     conf.Root,
+		counters: newCumulativeCounters(),
+	}
+}
+
+// Name returns the name of the collector.
+func (*CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+// Collect returns memory, CPU, I/O and pids usage of the cgroup.
+// The files of the disabled controllers are skipped, the unlimited limits are zero.
+func (c *CgroupCollector) Collect(_ context.Context) ([]*metric.Metric, error) {
+	var (
+		metrics []*metric.Metric
+		errs    []string
+	)
+
+	collect := func(ms []*metric.Metric, err error) {
+		metrics = append(metrics, ms...)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	collect(c.readGauge("memory.current", "CgroupMemoryCurrent"))
+	collect(c.readGauge("memory.max", "CgroupMemoryMax"))
+	collect(c.readGauge("pids.current", "CgroupPidsCurrent"))
+	collect(c.readGauge("pids.max", "CgroupPidsMax"))
+	collect(c.readCPUStat())
+	collect(c.readIOStat())
+
+	if len(errs) != 0 {
+		return metrics, errors.New(strings.Join(errs, "; "))
+	}
+	return metrics, nil
+}
+
+func (c *CgroupCollector) readGauge(file string, name string) ([]*metric.Metric, error) {
+	content, ok, err := c.read(file)
+	if !ok || err != nil {
+		return nil, err
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == unlimited {
+		return []*metric.Metric{metric.NewGauge(name, 0)}, nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "incorrect value in %s", file)
+	}
+
+	return []*metric.Metric{metric.NewGauge(name, v)}, nil
+}
+
+func (c *CgroupCollector) readCPUStat() ([]*metric.Metric, error) {
+	content, ok, err := c.read("cpu.stat")
+	if !ok || err != nil {
+		return nil, err
+	}
+
+	var metrics []*metric.Metric
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		name, ok := cpuStatCounters[fields[0]]
+		if !ok {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return metrics, errors.Wrapf(err, "incorrect value of %s in cpu.stat", fields[0])
+		}
+		metrics = append(metrics, c.counters.Counter(name, v))
+	}
+
+	return metrics, nil
+}
+
+func (c *CgroupCollector) readIOStat() ([]*metric.Metric, error) {
+	content, ok, err := c.read("io.stat")
+	if !ok || err != nil {
+		return nil, err
+	}
+
+	var metrics []*metric.Metric
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// The line format is "<major>:<minor> rbytes=1 wbytes=2 ..."
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		device := fields[0]
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			name, ok := ioStatCounters[key]
+			if !found || !ok {
+				continue
+			}
+
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return metrics, errors.Wrapf(err, "incorrect value of %s in io.stat", key)
+			}
+			metrics = append(metrics, c.counters.Counter(labeled(name, device), v))
+		}
+	}
+
+	return metrics, nil
+}
+
+// read returns the content of the file, ok is false if the file does not exist.
+func (c *CgroupCollector) read(file string) ([]byte, bool, error) {
+	content, err := os.ReadFile(filepath.Join(c.root, file))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to read %s", file)
+	}
+
+	return content, true, nil
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+func collectByName(t *testing.T, c Collector) map[string]*metric.Metric {
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	res := make(map[string]*metric.Metric, len(metrics))
+	for _, m := range metrics {
+		res[m.Name()] = m
+	}
+	return res
+}
+
+func TestCgroupCollector_Collect(t *testing.T) {
+	c := NewCgroupCollector(agentcfg.CgroupCollectorConfig{Root: "testdata/cgroup"})
+	metrics := collectByName(t, c)
+
+	assert.Equal(t, metric.NewGauge("CgroupMemoryCurrent", 104857600), metrics["CgroupMemoryCurrent"])
+	assert.Equal(t, metric.NewGauge("CgroupMemoryMax", 536870912), metrics["CgroupMemoryMax"])
+	assert.Equal(t, metric.NewGauge("CgroupPidsCurrent", 12), metrics["CgroupPidsCurrent"])
+	assert.Equal(t, metric.NewGauge("CgroupPidsMax", 0), metrics["CgroupPidsMax"], "unlimited value should be zero")
+
+	// The first observation of counters is zero
+	assert.Equal(t, metric.NewCounter("CgroupCPUUsageUsec", 0), metrics["CgroupCPUUsageUsec"])
+	assert.Equal(t, metric.NewCounter("CgroupIOReadBytes_8_0", 0), metrics["CgroupIOReadBytes_8_0"])
+	assert.Equal(t, metric.NewCounter("CgroupIOWriteOps_253_1", 0), metrics["CgroupIOWriteOps_253_1"])
+}
+
+func TestCgroupCollector_CollectCounters(t *testing.T) {
+	root := t.TempDir()
+	write := func(file string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), []byte(content), 0600))
+	}
+
+	c := NewCgroupCollector(agentcfg.CgroupCollectorConfig{Root: root})
+
+	write("cpu.stat", "usage_usec 1000\nuser_usec 600\nsystem_usec 400\n")
+	write("io.stat", "8:0 rbytes=100 wbytes=200 rios=1 wios=2\n")
+	collectByName(t, c)
+
+	write("cpu.stat", "usage_usec 1500\nuser_usec 900\nsystem_usec 600\n")
+	write("io.stat", "8:0 rbytes=150 wbytes=200 rios=2 wios=2\n")
+	metrics := collectByName(t, c)
+
+	assert.Equal(t, metric.NewCounter("CgroupCPUUsageUsec", 500), metrics["CgroupCPUUsageUsec"])
+	assert.Equal(t, metric.NewCounter("CgroupCPUUserUsec", 300), metrics["CgroupCPUUserUsec"])
+	assert.Equal(t, metric.NewCounter("CgroupIOReadBytes_8_0", 50), metrics["CgroupIOReadBytes_8_0"])
+	assert.Equal(t, metric.NewCounter("CgroupIOWriteBytes_8_0", 0), metrics["CgroupIOWriteBytes_8_0"])
+	assert.NotContains(t, metrics, "CgroupMemoryCurrent", "missing files should be skipped")
+}
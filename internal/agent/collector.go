@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// Collector gathers a set of metrics from a single source.
+type Collector interface {
+	// Name returns the name of the collector used in logs.
+	Name() string
+	// Collect returns the current values of the metrics.
+	Collect(ctx context.Context) ([]*metric.Metric, error)
+}
+
+// labeled encodes the label into the metric name, so the same metric of
+// different objects (mount points, interfaces, processes) are stored separately.
+func labeled(name string, label string) string {
+	return name + "_" + sanitizeLabel(label)
+}
+
+// labelSet detects the labels encoded into the same name, the metrics of such
+// objects would overwrite each other.
+type labelSet map[string]string
+
+// add returns an error if another label is encoded the same way, the metrics
+// of the label should be skipped then.
+func (s labelSet) add(label string) error {
+	sanitized := sanitizeLabel(label)
+	if other, ok := s[sanitized]; ok && other != label {
+		return errors.Errorf("labels '%s' and '%s' are both encoded as '%s'", other, label, sanitized)
+	}
+	s[sanitized] = label
+	return nil
+}
+
+func sanitizeLabel(label string) string {
+	res := strings.Trim(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, label), "_")
+
+	if res == "" {
+		return "root"
+	}
+	return res
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+// RegisterCollectors registers all the collectors enabled in the configuration.
+// To add a new collector, implement the Collector interface and register it here.
+func RegisterCollectors(r *Registry, conf agentcfg.CollectorsConfig, logService *loggerservice.LoggerService) error {
+	r.Register(conf.Runtime, NewRuntimeCollector())
+	r.Register(conf.System, NewSystemCollector())
+	r.Register(conf.Disk.CollectorConfig, NewDiskCollector(conf.Disk))
+	r.Register(conf.Network.CollectorConfig, NewNetworkCollector(conf.Network))
+	r.Register(conf.Process.CollectorConfig, NewProcessCollector(conf.Process))
+	r.Register(conf.Host, NewHostCollector())
+	r.Register(conf.Cgroup.CollectorConfig, NewCgroupCollector(conf.Cgroup))
+
+	if conf.Exec.Enabled {
+		execCollector, err := NewExecCollector(conf.Exec, logService)
+		if err != nil {
+			return err
+		}
+		r.Register(conf.Exec.CollectorConfig, execCollector)
+	}
+
+	return nil
+}
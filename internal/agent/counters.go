@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// cumulativeCounters converts the cumulative counters reported by the OS into
+// increments since the previous collection, as the storage sums counters up.
+type cumulativeCounters struct {
+	mx   sync.Mutex
+	prev map[string]uint64
+}
+
+func newCumulativeCounters() *cumulativeCounters {
+	return &cumulativeCounters{
+		prev: make(map[string]uint64),
+	}
+}
+
+// Counter returns the increment of the counter since the previous call.
+// The first observation and the reset of the source counter produce a zero increment.
+func (c *cumulativeCounters) Counter(name string, value uint64) *metric.Metric {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	prev, ok := c.prev[name]
+	c.prev[name] = value
+
+	var delta int64
+	if ok && value >= prev {
+		delta = int64(value - prev)
+	}
+
+	return metric.NewCounter(name, delta)
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// DiskCollector collects the usage of the mounted filesystems and the I/O of their devices.
+type DiskCollector struct {
+	mounts   filter
+	fsTypes  filter
+	counters *cumulativeCounters
+
+	// The sources of the stats, replaced in tests
+	partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+	ioCounters func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+}
+
+var _ Collector = (*DiskCollector)(nil)
+
+// NewDiskCollector instantiates a new DiskCollector.
+func NewDiskCollector(conf agentcfg.DiskCollectorConfig) *DiskCollector {
+	return &DiskCollector{
+		mounts:   newFilter(conf.IncludeMounts, conf.ExcludeMounts),
+		fsTypes:  newFilter(conf.IncludeFSTypes, conf.ExcludeFSTypes),
+		counters: newCumulativeCounters(),
+
+		partitions: disk.PartitionsWithContext,
+		usage:      disk.UsageWithContext,
+		ioCounters: disk.IOCountersWithContext,
+	}
+}
+
+// Name returns the name of the collector.
+func (*DiskCollector) Name() string {
+	return "disk"
+}
+
+// Collect returns the usage per mount point and the I/O per device.
+func (c *DiskCollector) Collect(ctx context.Context) ([]*metric.Metric, error) {
+	partitions, err := c.partitions(ctx, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read partitions")
+	}
+
+	var (
+		metrics  []*metric.Metric
+		devices  []string
+		firstErr error
+	)
+	mounts := make(labelSet, len(partitions))
+	for _, p := range partitions {
+		if !c.mounts.Allowed(p.Mountpoint) || !c.fsTypes.Allowed(p.Fstype) {
+			continue
+		}
+		if err := mounts.add(p.Mountpoint); err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrap(err, "mount point is skipped")
+			}
+			continue
+		}
+
+		usage, err := c.usage(ctx, p.Mountpoint)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "failed to read usage of %s", p.Mountpoint)
+			}
+			continue
+		}
+
+		metrics = append(metrics,
+			metric.NewGauge(labeled("DiskTotal", p.Mountpoint), float64(usage.Total)),
+			metric.NewGauge(labeled("DiskUsed", p.Mountpoint), float64(usage.Used)),
+			metric.NewGauge(labeled("DiskFree", p.Mountpoint), float64(usage.Free)),
+			metric.NewGauge(labeled("DiskUsedPercent", p.Mountpoint), usage.UsedPercent),
+			metric.NewGauge(labeled("DiskInodesTotal", p.Mountpoint), float64(usage.InodesTotal)),
+			metric.NewGauge(labeled("DiskInodesUsed", p.Mountpoint), float64(usage.InodesUsed)),
+			metric.NewGauge(labeled("DiskInodesFree", p.Mountpoint), float64(usage.InodesFree)),
+		)
+		devices = append(devices, filepath.Base(p.Device))
+	}
+
+	if len(devices) == 0 {
+		return metrics, firstErr
+	}
+
+	ioCounters, err := c.ioCounters(ctx, devices...)
+	if err != nil {
+		return metrics, errors.Wrap(err, "failed to read I/O counters")
+	}
+
+	names := make(labelSet, len(ioCounters))
+	for device, io := range ioCounters {
+		if err := names.add(device); err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrap(err, "device is skipped")
+			}
+			continue
+		}
+		metrics = append(metrics,
+			c.counters.Counter(labeled("DiskReadBytes", device), io.ReadBytes),
+			c.counters.Counter(labeled("DiskWriteBytes", device), io.WriteBytes),
+			c.counters.Counter(labeled("DiskReadOps", device), io.ReadCount),
+			c.counters.Counter(labeled("DiskWriteOps", device), io.WriteCount),
+		)
+	}
+
+	return metrics, firstErr
+}
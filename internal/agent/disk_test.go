@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+func newFakeDiskCollector(conf agentcfg.DiskCollectorConfig, io map[string]disk.IOCountersStat) *DiskCollector {
+	c := NewDiskCollector(conf)
+	c.partitions = func(context.Context, bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sdb1", Mountpoint: "/data", Fstype: "xfs"},
+			{Device: "tmpfs", Mountpoint: "/run", Fstype: "tmpfs"},
+		}, nil
+	}
+	c.usage = func(_ context.Context, path string) (*disk.UsageStat, error) {
+		return &disk.UsageStat{
+			Path:        path,
+			Total:       1000,
+			Used:        250,
+			Free:        750,
+			UsedPercent: 25,
+			InodesTotal: 100,
+			InodesUsed:  10,
+			InodesFree:  90,
+		}, nil
+	}
+	c.ioCounters = func(_ context.Context, names ...string) (map[string]disk.IOCountersStat, error) {
+		res := make(map[string]disk.IOCountersStat, len(names))
+		for _, name := range names {
+			if stat, ok := io[name]; ok {
+				res[name] = stat
+			}
+		}
+		return res, nil
+	}
+	return c
+}
+
+func TestDiskCollector_Collect(t *testing.T) {
+	io := map[string]disk.IOCountersStat{
+		"sda1": {ReadBytes: 100, WriteBytes: 200, ReadCount: 1, WriteCount: 2},
+		"sdb1": {ReadBytes: 1000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20},
+	}
+
+	tests := []struct {
+		name    string
+		conf    agentcfg.DiskCollectorConfig
+		want    []*metric.Metric
+		missing []string
+	}{
+		{
+			name: "usage of the mount points",
+			conf: agentcfg.DiskCollectorConfig{ExcludeFSTypes: []string{"tmpfs"}},
+			want: []*metric.Metric{
+				metric.NewGauge("DiskTotal_root", 1000),
+				metric.NewGauge("DiskUsed_root", 250),
+				metric.NewGauge("DiskFree_root", 750),
+				metric.NewGauge("DiskUsedPercent_root", 25),
+				metric.NewGauge("DiskInodesTotal_data", 100),
+				metric.NewGauge("DiskInodesUsed_data", 10),
+				metric.NewGauge("DiskInodesFree_data", 90),
+				metric.NewCounter("DiskReadBytes_sda1", 0),
+				metric.NewCounter("DiskWriteOps_sdb1", 0),
+			},
+			missing: []string{"DiskTotal_run"},
+		},
+		{
+			name: "included mount points",
+			conf: agentcfg.DiskCollectorConfig{IncludeMounts: []string{"/data"}},
+			want: []*metric.Metric{
+				metric.NewGauge("DiskTotal_data", 1000),
+				metric.NewCounter("DiskReadBytes_sdb1", 0),
+			},
+			missing: []string{"DiskTotal_root", "DiskTotal_run", "DiskReadBytes_sda1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := collectByName(t, newFakeDiskCollector(tt.conf, io))
+			for _, want := range tt.want {
+				assert.Equal(t, want, metrics[want.Name()])
+			}
+			for _, name := range tt.missing {
+				assert.NotContains(t, metrics, name)
+			}
+		})
+	}
+}
+
+func TestDiskCollector_CollectCounters(t *testing.T) {
+	io := map[string]disk.IOCountersStat{
+		"sda1": {ReadBytes: 100, WriteBytes: 200, ReadCount: 1, WriteCount: 2},
+	}
+	c := newFakeDiskCollector(agentcfg.DiskCollectorConfig{IncludeMounts: []string{"/"}}, io)
+	collectByName(t, c)
+
+	io["sda1"] = disk.IOCountersStat{ReadBytes: 150, WriteBytes: 200, ReadCount: 3, WriteCount: 2}
+	metrics := collectByName(t, c)
+
+	assert.Equal(t, metric.NewCounter("DiskReadBytes_sda1", 50), metrics["DiskReadBytes_sda1"])
+	assert.Equal(t, metric.NewCounter("DiskWriteBytes_sda1", 0), metrics["DiskWriteBytes_sda1"])
+	assert.Equal(t, metric.NewCounter("DiskReadOps_sda1", 2), metrics["DiskReadOps_sda1"])
+}
+
+func TestDiskCollector_CollidingMounts(t *testing.T) {
+	c := newFakeDiskCollector(agentcfg.DiskCollectorConfig{}, nil)
+	c.partitions = func(context.Context, bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/var/lib", Fstype: "ext4"},
+			{Device: "/dev/sdb1", Mountpoint: "/var_lib", Fstype: "ext4"},
+		}, nil
+	}
+
+	// The metrics of the second mount point would overwrite the first one
+	metrics, err := c.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, metrics, 7)
+}
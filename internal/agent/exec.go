@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+const (
+	// FormatJSON is the output in the same shape as the body of /updates/.
+	FormatJSON = "json"
+	// FormatLines is the output of "name value [type]" lines, the type is gauge by default.
+	FormatLines = "lines"
+)
+
+const (
+	// maxOutputSize limits the output of a command kept in memory, the metrics
+	// are not parsed from a truncated output.
+	maxOutputSize = 1 << 20
+	// maxStderrSize limits the logged error output of a command.
+	maxStderrSize = 64 << 10
+)
+
+// ExecCollector runs the configured commands and parses the metrics from their output.
+//
+// Following the Nagios convention, the exit code of every command is reported
+// as the ExecStatus gauge, the output is parsed regardless of the exit code.
+type ExecCollector struct {
+	commands []agentcfg.ExecCommandConfig
+	sem      chan struct{}
+	logger   zerolog.Logger
+}
+
+var _ Collector = (*ExecCollector)(nil)
+
+// NewExecCollector instantiates a new ExecCollector.
+func NewExecCollector(conf agentcfg.ExecCollectorConfig, logService *loggerservice.LoggerService) (*ExecCollector, error) {
+	for _, cmd := range conf.Commands {
+		if cmd.Name == "" || len(cmd.Command) == 0 {
+			return nil, errors.New("exec collector: every command should have a name and a command")
+		}
+		if cmd.Format != FormatJSON && cmd.Format != FormatLines {
+			return nil, errors.Errorf("exec collector: unknown format '%s' of command %s", cmd.Format, cmd.Name)
+		}
+	}
+
+	concurrency := conf.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &ExecCollector{
+		commands: conf.Commands,
+		sem:      make(chan struct{}, concurrency),
+		logger:   logService.ComponentLogger("ExecCollector"),
+	}, nil
+}
+
+// Name returns the name of the collector.
+func (*ExecCollector) Name() string {
+	return "exec"
+}
+
+// Collect runs all the commands and returns the metrics they reported.
+func (c *ExecCollector) Collect(ctx context.Context) ([]*metric.Metric, error) {
+	var (
+		wg      sync.WaitGroup
+		mx      sync.Mutex
+		metrics []*metric.Metric
+		errs    []string
+	)
+
+	for _, cmd := range c.commands {
+		wg.Add(1)
+		go func(cmd agentcfg.ExecCommandConfig) {
+			defer wg.Done()
+
+			select {
+			case c.sem <- struct{}{}:
+				defer func() { <-c.sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			ms, err := c.run(ctx, cmd)
+
+			mx.Lock()
+			defer mx.Unlock()
+			metrics = append(metrics, ms...)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}(cmd)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return metrics, errors.New(strings.Join(errs, "; "))
+	}
+	return metrics, nil
+}
+
+func (c *ExecCollector) run(ctx context.Context, conf agentcfg.ExecCommandConfig) ([]*metric.Metric, error) {
+	if conf.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Timeout)
+		defer cancel()
+	}
+
+	stdout := &cappedBuffer{limit: maxOutputSize}
+	stderr := &cappedBuffer{limit: maxStderrSize}
+	cmd := exec.CommandContext(ctx, conf.Command[0], conf.Command[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	c.logStderr(conf.Name, stderr)
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, errors.Wrapf(err, "command %s failed", conf.Name)
+	}
+
+	status := []*metric.Metric{
+		metric.NewGauge(labeled("ExecStatus", conf.Name), float64(cmd.ProcessState.ExitCode())),
+		metric.NewGauge(labeled("ExecDurationSeconds", conf.Name), time.Since(start).Seconds()),
+	}
+	if stdout.truncated {
+		return status, errors.Errorf("output of command %s exceeds %d bytes", conf.Name, maxOutputSize)
+	}
+
+	metrics, parseErr := parseOutput(conf.Format, stdout.Bytes())
+	metrics = append(metrics, status...)
+	if parseErr != nil {
+		return metrics, errors.Wrapf(parseErr, "failed to parse output of command %s", conf.Name)
+	}
+
+	return metrics, nil
+}
+
+func (c *ExecCollector) logStderr(name string, stderr *cappedBuffer) {
+	scanner := bufio.NewScanner(bytes.NewReader(stderr.Bytes()))
+	for scanner.Scan() {
+		c.logger.Warn().Str("command", name).Msg(scanner.Text())
+	}
+	if stderr.truncated {
+		c.logger.Warn().Str("command", name).Msgf("error output exceeds %d bytes and is truncated", maxStderrSize)
+	}
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the rest,
+// so a command writing endlessly does not exhaust the memory. The buffer is not
+// embedded, otherwise io.Copy would bypass Write with its ReadFrom.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		// The command keeps running, its output is just not kept
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the kept output.
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func parseOutput(format string, output []byte) ([]*metric.Metric, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSON(output)
+	case FormatLines:
+		return parseLines(output)
+	default:
+		return nil, errors.Errorf("unknown format '%s'", format)
+	}
+}
+
+func parseJSON(output []byte) ([]*metric.Metric, error) {
+	var metrics []*metric.Metric
+	if err := json.Unmarshal(output, &metrics); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal metrics")
+	}
+
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "incorrect metric %v", m)
+		}
+	}
+
+	return metrics, nil
+}
+
+func parseLines(output []byte) ([]*metric.Metric, error) {
+	var metrics []*metric.Metric
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return metrics, errors.Errorf("line %d: expected 'name value [type]', got '%s'", lineNum, line)
+		}
+
+		metricType := metric.Gauge
+		if len(fields) == 3 {
+			var err error
+			if metricType, err = metric.TypeFromString(fields[2]); err != nil {
+				return metrics, errors.Wrapf(err, "line %d", lineNum)
+			}
+		}
+
+		m, err := newMetric(metricType, fields[0], fields[1])
+		if err != nil {
+			return metrics, errors.Wrapf(err, "line %d", lineNum)
+		}
+		metrics = append(metrics, m)
+	}
+
+	return metrics, nil
+}
+
+func newMetric(metricType metric.Type, name string, value string) (*metric.Metric, error) {
+	if metricType == metric.Counter {
+		delta, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "expected counter value to be int64, got '%s'", value)
+		}
+		return metric.NewCounter(name, delta), nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "expected gauge value to be float64, got '%s'", value)
+	}
+	return metric.NewGauge(name, v), nil
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+func Test_parseOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		output  string
+		want    []*metric.Metric
+		wantErr bool
+	}{
+		{
+			name:   "lines",
+			format: FormatLines,
+			output: "# comment\nQueueDepth 12\n\nJobsDone 3 counter\nLag 0.5 gauge\n",
+			want: []*metric.Metric{
+				metric.NewGauge("QueueDepth", 12),
+				metric.NewCounter("JobsDone", 3),
+				metric.NewGauge("Lag", 0.5),
+			},
+		},
+		{
+			name:    "lines with unknown type",
+			format:  FormatLines,
+			output:  "JobsDone 3 histogram\n",
+			wantErr: true,
+		},
+		{
+			name:    "lines with incorrect counter",
+			format:  FormatLines,
+			output:  "JobsDone 3.5 counter\n",
+			wantErr: true,
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			output: `[{"id":"QueueDepth","type":"gauge","value":12},{"id":"JobsDone","type":"counter","delta":3}]`,
+			want: []*metric.Metric{
+				metric.NewGauge("QueueDepth", 12),
+				metric.NewCounter("JobsDone", 3),
+			},
+		},
+		{
+			name:    "json without value",
+			format:  FormatJSON,
+			output:  `[{"id":"QueueDepth","type":"gauge"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOutput(tt.format, []byte(tt.output))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExecCollector_Collect(t *testing.T) {
+	c, err := NewExecCollector(agentcfg.ExecCollectorConfig{
+		MaxConcurrency: 1,
+		Commands: []agentcfg.ExecCommandConfig{
+			{
+				Name:    "queue",
+				Command: []string{"sh", "-c", "echo 'QueueDepth 12'; echo 'queue is almost full' >&2; exit 1"},
+				Format:  FormatLines,
+			},
+		},
+	}, loggerservice.New())
+	require.NoError(t, err)
+
+	metrics := collectByName(t, c)
+	assert.Equal(t, metric.NewGauge("QueueDepth", 12), metrics["QueueDepth"])
+	assert.Equal(t, metric.NewGauge("ExecStatus_queue", 1), metrics["ExecStatus_queue"])
+	assert.Contains(t, metrics, "ExecDurationSeconds_queue")
+}
+
+func TestExecCollector_TruncatedOutput(t *testing.T) {
+	c, err := NewExecCollector(agentcfg.ExecCollectorConfig{
+		Commands: []agentcfg.ExecCommandConfig{
+			{
+				Name:    "chatty",
+				Command: []string{"sh", "-c", "while :; do echo 'QueueDepth 12'; done | head -c 2000000"},
+				Format:  FormatLines,
+			},
+		},
+	}, loggerservice.New())
+	require.NoError(t, err)
+
+	// The metrics are not parsed from the truncated output, the status is still reported
+	metrics, err := c.Collect(context.Background())
+	require.Error(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, metric.NewGauge("ExecStatus_chatty", 0), metrics[0])
+}
+
+func Test_cappedBuffer(t *testing.T) {
+	b := &cappedBuffer{limit: 4}
+
+	n, err := b.Write([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.False(t, b.truncated)
+
+	n, err = b.Write([]byte("def"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.True(t, b.truncated)
+	assert.Equal(t, "abcd", string(b.Bytes()))
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage"
+)
+
+// Exporter serves the collected metrics over HTTP for the pull mode.
+//
+// GET /metrics returns the metrics in the Prometheus text format,
+// GET /metrics/json returns them in the same JSON as the body of /updates/.
+//
+// The metrics are served in plain HTTP, so the address should only be reachable
+// by the server, e.g. localhost or a private network. If the token is set, the
+// requests should carry it as a bearer token.
+type Exporter struct {
+	store  storage.Storage
+	token  string
+	server *http.Server
+	logger zerolog.Logger
+}
+
+// NewExporter instantiates a new Exporter, the token is not checked if empty.
+func NewExporter(address, token string, store storage.Storage, logService *loggerservice.LoggerService) *Exporter {
+	e := &Exporter{
+		store:  store,
+		token:  token,
+		logger: logService.ComponentLogger("Exporter"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.prometheusHandler)
+	mux.HandleFunc("/metrics/json", e.jsonHandler)
+	e.server = &http.Server{
+		Addr:    address,
+		Handler: e.authenticate(mux),
+	}
+
+	return e
+}
+
+// Start starts listening, the returned channel receives an error if the server fails.
+func (e *Exporter) Start() <-chan error {
+	out := make(chan error, 1)
+
+	go func() {
+		e.logger.Info().Msgf("exporter is listening on address %s", e.server.Addr)
+		if err := e.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			out <- errors.Wrap(err, "exporter failed")
+		}
+	}()
+
+	return out
+}
+
+// Stop stops the server gracefully.
+func (e *Exporter) Stop(ctx context.Context) error {
+	return e.server.Shutdown(ctx)
+}
+
+func (e *Exporter) authenticate(next http.Handler) http.Handler {
+	if e.token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + e.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (e *Exporter) jsonHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(e.store.All(r.Context())); err != nil {
+		e.logger.Error().Err(err).Msg("failed to write metrics")
+	}
+}
+
+func (e *Exporter) prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	text, skipped := prometheusText(e.store.All(r.Context()))
+	for _, name := range skipped {
+		e.logger.Warn().Msgf("metric %s is not exported, its name collides with another metric", name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := w.Write([]byte(text)); err != nil {
+		e.logger.Error().Err(err).Msg("failed to write metrics")
+	}
+}
+
+// prometheusText renders the metrics in the Prometheus text exposition format.
+// A name may be written only once, so the metrics which names collide with
+// a metric before them once sanitized or of another type are skipped and returned.
+func prometheusText(metrics []*metric.Metric) (string, []string) {
+	sorted := make([]*metric.Metric, len(metrics))
+	copy(sorted, metrics)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name() != sorted[j].Name() {
+			return sorted[i].Name() < sorted[j].Name()
+		}
+		return sorted[i].MType < sorted[j].MType
+	})
+
+	var sb strings.Builder
+	var skipped []string
+	written := make(map[string]bool, len(sorted))
+	for _, m := range sorted {
+		name := prometheusName(m.Name())
+		if written[name] {
+			skipped = append(skipped, m.Name())
+			continue
+		}
+		written[name] = true
+
+		fmt.Fprintf(&sb, "# TYPE %s %s\n", name, m.StrType())
+		switch m.Type() {
+		case metric.Gauge:
+			fmt.Fprintf(&sb, "%s %v\n", name, *m.Value)
+		case metric.Counter:
+			fmt.Fprintf(&sb, "%s %d\n", name, *m.Delta)
+		}
+	}
+
+	return sb.String(), skipped
+}
+
+// prometheusName replaces the characters which are not allowed in Prometheus metric names.
+func prometheusName(name string) string {
+	res := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':') {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if res == "" || unicode.IsDigit(rune(res[0])) {
+		res = "_" + res
+	}
+	return res
+}
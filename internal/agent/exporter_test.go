@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage/memstorage"
+)
+
+func Test_prometheusText(t *testing.T) {
+	metrics := []*metric.Metric{
+		metric.NewGauge("DiskUsed_var.lib", 1.5),
+		metric.NewCounter("PollCount", 7),
+	}
+
+	want := "# TYPE DiskUsed_var_lib gauge\n" +
+		"DiskUsed_var_lib 1.5\n" +
+		"# TYPE PollCount counter\n" +
+		"PollCount 7\n"
+
+	text, skipped := prometheusText(metrics)
+	assert.Equal(t, want, text)
+	assert.Empty(t, skipped)
+}
+
+func Test_prometheusTextCollisions(t *testing.T) {
+	metrics := []*metric.Metric{
+		metric.NewGauge("DiskUsed_var_lib", 2),
+		metric.NewGauge("DiskUsed_var.lib", 1),
+		metric.NewGauge("PollCount", 3),
+		metric.NewCounter("PollCount", 7),
+	}
+
+	want := "# TYPE DiskUsed_var_lib gauge\n" +
+		"DiskUsed_var_lib 1\n" +
+		"# TYPE PollCount counter\n" +
+		"PollCount 7\n"
+
+	text, skipped := prometheusText(metrics)
+	assert.Equal(t, want, text)
+	assert.Equal(t, []string{"DiskUsed_var_lib", "PollCount"}, skipped)
+}
+
+func TestExporter_Handlers(t *testing.T) {
+	logService := loggerservice.New()
+	store := memstorage.NewMemStorage("", logService)
+	_, err := store.Update(context.Background(), metric.NewCounter("PollCount", 7))
+	require.NoError(t, err)
+
+	e := NewExporter("", "", store, logService)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		wantCode    int
+		wantType    string
+		wantBody    string
+		wantMetrics []*metric.Metric
+	}{
+		{
+			name:     "prometheus format",
+			method:   http.MethodGet,
+			target:   "/metrics",
+			wantCode: http.StatusOK,
+			wantType: "text/plain; version=0.0.4",
+			wantBody: "# TYPE PollCount counter\nPollCount 7\n",
+		},
+		{
+			name:        "json format",
+			method:      http.MethodGet,
+			target:      "/metrics/json",
+			wantCode:    http.StatusOK,
+			wantType:    "application/json",
+			wantMetrics: []*metric.Metric{metric.NewCounter("PollCount", 7)},
+		},
+		{
+			name:     "prometheus format only for GET",
+			method:   http.MethodPost,
+			target:   "/metrics",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:     "json format only for GET",
+			method:   http.MethodPost,
+			target:   "/metrics/json",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			e.server.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			if tt.wantMetrics != nil {
+				var got []*metric.Metric
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				assert.Equal(t, tt.wantMetrics, got)
+			} else {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestExporter_Token(t *testing.T) {
+	logService := loggerservice.New()
+	e := NewExporter("", "secret", memstorage.NewMemStorage("", logService), logService)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+	}{
+		{name: "no token", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer other", wantCode: http.StatusUnauthorized},
+		{name: "valid token", authorization: "Bearer secret", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics/json", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			e.server.Handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"path/filepath"
+)
+
+// filter selects the objects by their names using glob patterns.
+type filter struct {
+	include []string
+	exclude []string
+}
+
+func newFilter(include []string, exclude []string) filter {
+	return filter{
+		include: include,
+		exclude: exclude,
+	}
+}
+
+// Allowed reports whether the name matches any of the include patterns (if any)
+// and none of the exclude ones.
+func (f filter) Allowed(name string) bool {
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := filepath.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
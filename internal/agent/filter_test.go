@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_filter_Allowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		value   string
+		want    bool
+	}{
+		{
+			name:  "empty filter allows everything",
+			value: "/",
+			want:  true,
+		},
+		{
+			name:    "included",
+			include: []string{"/var/*", "/"},
+			value:   "/var/lib",
+			want:    true,
+		},
+		{
+			name:    "not included",
+			include: []string{"/var/*"},
+			value:   "/home",
+			want:    false,
+		},
+		{
+			name:    "excluded",
+			exclude: []string{"tmpfs", "overlay"},
+			value:   "tmpfs",
+			want:    false,
+		},
+		{
+			name:    "excluded wins",
+			include: []string{"eth*"},
+			exclude: []string{"eth1"},
+			value:   "eth1",
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newFilter(tt.include, tt.exclude).Allowed(tt.value))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// HostCollector collects the load average, uptime, processes and swap usage of the host.
+type HostCollector struct {
+	// The sources of the stats, replaced in tests
+	loadAvg  func(ctx context.Context) (*load.AvgStat, error)
+	loadMisc func(ctx context.Context) (*load.MiscStat, error)
+	uptime   func(ctx context.Context) (uint64, error)
+	bootTime func(ctx context.Context) (uint64, error)
+	swap     func(ctx context.Context) (*mem.SwapMemoryStat, error)
+}
+
+var _ Collector = (*HostCollector)(nil)
+
+// NewHostCollector instantiates a new HostCollector.
+func NewHostCollector() *HostCollector {
+	return &HostCollector{
+		loadAvg:  load.AvgWithContext,
+		loadMisc: load.MiscWithContext,
+		uptime:   host.UptimeWithContext,
+		bootTime: host.BootTimeWithContext,
+		swap:     mem.SwapMemoryWithContext,
+	}
+}
+
+// Name returns the name of the collector.
+func (*HostCollector) Name() string {
+	return "host"
+}
+
+// Collect returns the host level metrics.
+func (c *HostCollector) Collect(ctx context.Context) ([]*metric.Metric, error) {
+	avg, err := c.loadAvg(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read load average")
+	}
+
+	misc, err := c.loadMisc(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read processes stats")
+	}
+
+	uptime, err := c.uptime(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read uptime")
+	}
+
+	bootTime, err := c.bootTime(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read boot time")
+	}
+
+	swap, err := c.swap(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read swap stats")
+	}
+
+	return []*metric.Metric{
+		metric.NewGauge("Load1", avg.Load1),
+		metric.NewGauge("Load5", avg.Load5),
+		metric.NewGauge("Load15", avg.Load15),
+		metric.NewGauge("Uptime", float64(uptime)),
+		metric.NewGauge("BootTime", float64(bootTime)),
+		metric.NewGauge("ProcsTotal", float64(misc.ProcsTotal)),
+		metric.NewGauge("ProcsRunning", float64(misc.ProcsRunning)),
+		metric.NewGauge("ProcsBlocked", float64(misc.ProcsBlocked)),
+		metric.NewGauge("SwapUsed", float64(swap.Used)),
+		metric.NewGauge("SwapFree", float64(swap.Free)),
+	}, nil
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeHostCollector() *HostCollector {
+	return &HostCollector{
+		loadAvg: func(context.Context) (*load.AvgStat, error) {
+			return &load.AvgStat{Load1: 1.5, Load5: 1, Load15: 0.5}, nil
+		},
+		loadMisc: func(context.Context) (*load.MiscStat, error) {
+			return &load.MiscStat{ProcsTotal: 200, ProcsRunning: 3, ProcsBlocked: 1}, nil
+		},
+		uptime: func(context.Context) (uint64, error) {
+			return 3600, nil
+		},
+		bootTime: func(context.Context) (uint64, error) {
+			return 1_700_000_000, nil
+		},
+		swap: func(context.Context) (*mem.SwapMemoryStat, error) {
+			return &mem.SwapMemoryStat{Used: 1024, Free: 4096}, nil
+		},
+	}
+}
+
+func TestHostCollector_Collect(t *testing.T) {
+	metrics := collectByName(t, newFakeHostCollector())
+
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{name: "Load1", want: 1.5},
+		{name: "Load5", want: 1},
+		{name: "Load15", want: 0.5},
+		{name: "Uptime", want: 3600},
+		{name: "BootTime", want: 1_700_000_000},
+		{name: "ProcsTotal", want: 200},
+		{name: "ProcsRunning", want: 3},
+		{name: "ProcsBlocked", want: 1},
+		{name: "SwapUsed", want: 1024},
+		{name: "SwapFree", want: 4096},
+	}
+	assert.Len(t, metrics, len(tests))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if assert.Contains(t, metrics, tt.name) {
+				assert.Equal(t, tt.want, *metrics[tt.name].Value)
+			}
+		})
+	}
+}
+
+func TestHostCollector_CollectError(t *testing.T) {
+	c := newFakeHostCollector()
+	c.swap = func(context.Context) (*mem.SwapMemoryStat, error) {
+		return nil, errors.New("no swap stats")
+	}
+
+	_, err := c.Collect(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	psnet "github.com/shirou/gopsutil/v3/net"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// tcpStates are reported even if there are no connections in the state,
+// so the stale values are reset.
+var tcpStates = []string{
+	"ESTABLISHED",
+	"SYN_SENT",
+	"SYN_RECV",
+	"FIN_WAIT1",
+	"FIN_WAIT2",
+	"TIME_WAIT",
+	"CLOSE",
+	"CLOSE_WAIT",
+	"LAST_ACK",
+	"LISTEN",
+	"CLOSING",
+}
+
+// NetworkCollector collects the traffic of the network interfaces and the TCP connections by state.
+type NetworkCollector struct {
+	interfaces filter
+	counters   *cumulativeCounters
+
+	// The sources of the stats, replaced in tests
+	ioCounters  func(ctx context.Context, pernic bool) ([]psnet.IOCountersStat, error)
+	connections func(ctx context.Context, kind string) ([]psnet.ConnectionStat, error)
+}
+
+var _ Collector = (*NetworkCollector)(nil)
+
+// NewNetworkCollector instantiates a new NetworkCollector.
+func NewNetworkCollector(conf agentcfg.NetworkCollectorConfig) *NetworkCollector {
+	return &NetworkCollector{
+		interfaces: newFilter(conf.IncludeInterfaces, conf.ExcludeInterfaces),
+		counters:   newCumulativeCounters(),
+
+		ioCounters:  psnet.IOCountersWithContext,
+		connections: psnet.ConnectionsWithContext,
+	}
+}
+
+// Name returns the name of the collector.
+func (*NetworkCollector) Name() string {
+	return "network"
+}
+
+// Collect returns the counters per interface and the amount of TCP connections per state.
+func (c *NetworkCollector) Collect(ctx context.Context) ([]*metric.Metric, error) {
+	ioCounters, err := c.ioCounters(ctx, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read network I/O counters")
+	}
+
+	var (
+		metrics  []*metric.Metric
+		firstErr error
+	)
+	names := make(labelSet, len(ioCounters))
+	for _, io := range ioCounters {
+		if !c.interfaces.Allowed(io.Name) {
+			continue
+		}
+		if err := names.add(io.Name); err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrap(err, "interface is skipped")
+			}
+			continue
+		}
+
+		metrics = append(metrics,
+			c.counters.Counter(labeled("NetBytesSent", io.Name), io.BytesSent),
+			c.counters.Counter(labeled("NetBytesRecv", io.Name), io.BytesRecv),
+			c.counters.Counter(labeled("NetPacketsSent", io.Name), io.PacketsSent),
+			c.counters.Counter(labeled("NetPacketsRecv", io.Name), io.PacketsRecv),
+			c.counters.Counter(labeled("NetErrIn", io.Name), io.Errin),
+			c.counters.Counter(labeled("NetErrOut", io.Name), io.Errout),
+			c.counters.Counter(labeled("NetDropIn", io.Name), io.Dropin),
+			c.counters.Counter(labeled("NetDropOut", io.Name), io.Dropout),
+		)
+	}
+
+	connections, err := c.connections(ctx, "tcp")
+	if err != nil {
+		return metrics, errors.Wrap(err, "failed to read TCP connections")
+	}
+
+	byState := make(map[string]int, len(tcpStates))
+	for _, state := range tcpStates {
+		byState[state] = 0
+	}
+	for _, conn := range connections {
+		byState[conn.Status]++
+	}
+
+	for state, count := range byState {
+		metrics = append(metrics, metric.NewGauge(labeled("TCPConnections", state), float64(count)))
+	}
+
+	return metrics, firstErr
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+func TestNetworkCollector_Collect(t *testing.T) {
+	io := []psnet.IOCountersStat{
+		{Name: "lo", BytesSent: 10, BytesRecv: 10},
+		{Name: "eth0", BytesSent: 100, BytesRecv: 200, PacketsSent: 1, PacketsRecv: 2, Errin: 3, Dropout: 4},
+	}
+
+	c := NewNetworkCollector(agentcfg.NetworkCollectorConfig{ExcludeInterfaces: []string{"lo"}})
+	c.ioCounters = func(context.Context, bool) ([]psnet.IOCountersStat, error) {
+		return io, nil
+	}
+	c.connections = func(context.Context, string) ([]psnet.ConnectionStat, error) {
+		return []psnet.ConnectionStat{
+			{Status: "ESTABLISHED"},
+			{Status: "ESTABLISHED"},
+			{Status: "LISTEN"},
+		}, nil
+	}
+
+	metrics := collectByName(t, c)
+	assert.NotContains(t, metrics, "NetBytesSent_lo", "excluded interface")
+
+	tests := []struct {
+		name string
+		want *metric.Metric
+	}{
+		{name: "first observation of a counter", want: metric.NewCounter("NetBytesSent_eth0", 0)},
+		{name: "established connections", want: metric.NewGauge("TCPConnections_ESTABLISHED", 2)},
+		{name: "listening sockets", want: metric.NewGauge("TCPConnections_LISTEN", 1)},
+		{name: "state without connections", want: metric.NewGauge("TCPConnections_TIME_WAIT", 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, metrics[tt.want.Name()])
+		})
+	}
+
+	io[1] = psnet.IOCountersStat{Name: "eth0", BytesSent: 150, BytesRecv: 200, PacketsSent: 3, PacketsRecv: 2, Errin: 3, Dropout: 5}
+	metrics = collectByName(t, c)
+
+	assert.Equal(t, metric.NewCounter("NetBytesSent_eth0", 50), metrics["NetBytesSent_eth0"])
+	assert.Equal(t, metric.NewCounter("NetBytesRecv_eth0", 0), metrics["NetBytesRecv_eth0"])
+	assert.Equal(t, metric.NewCounter("NetPacketsSent_eth0", 2), metrics["NetPacketsSent_eth0"])
+	assert.Equal(t, metric.NewCounter("NetDropOut_eth0", 1), metrics["NetDropOut_eth0"])
+}
+
+func TestNetworkCollector_CollidingInterfaces(t *testing.T) {
+	c := NewNetworkCollector(agentcfg.NetworkCollectorConfig{})
+	c.ioCounters = func(context.Context, bool) ([]psnet.IOCountersStat, error) {
+		return []psnet.IOCountersStat{
+			{Name: "eth0_1", BytesSent: 100},
+			{Name: "eth0:1", BytesSent: 200},
+		}, nil
+	}
+	c.connections = func(context.Context, string) ([]psnet.ConnectionStat, error) {
+		return nil, nil
+	}
+
+	// The counters of the second interface would be mixed up with the first one
+	metrics, err := c.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, metrics, 8+len(tcpStates))
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+type cpuSample struct {
+	seconds float64
+	at      time.Time
+}
+
+// proc is the part of process.Process used by the collector, it is faked in tests.
+type proc interface {
+	PID() int32
+	NameWithContext(ctx context.Context) (string, error)
+	TimesWithContext(ctx context.Context) (*cpu.TimesStat, error)
+	MemoryInfoWithContext(ctx context.Context) (*process.MemoryInfoStat, error)
+	NumFDsWithContext(ctx context.Context) (int32, error)
+	NumThreadsWithContext(ctx context.Context) (int32, error)
+}
+
+type psProcess struct {
+	*process.Process
+}
+
+func (p psProcess) PID() int32 {
+	return p.Pid
+}
+
+func listProcesses(ctx context.Context) ([]proc, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	res := make([]proc, 0, len(procs))
+	for _, p := range procs {
+		res = append(res, psProcess{p})
+	}
+	return res, err
+}
+
+func newProcess(ctx context.Context, pid int32) (proc, error) {
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	return psProcess{p}, nil
+}
+
+type processStats struct {
+	count      int
+	cpuPercent float64
+	rss        uint64
+	fds        int32
+	threads    int32
+}
+
+// ProcessCollector collects the resource usage of the configured processes.
+// The processes with the same name are aggregated, the name is used as a label.
+type ProcessCollector struct {
+	names    []string
+	pidFiles []string
+
+	mx      sync.Mutex
+	samples map[int32]cpuSample
+
+	// The sources of the stats, replaced in tests
+	processes  func(ctx context.Context) ([]proc, error)
+	newProcess func(ctx context.Context, pid int32) (proc, error)
+	now        func() time.Time
+}
+
+var _ Collector = (*ProcessCollector)(nil)
+
+// NewProcessCollector instantiates a new ProcessCollector.
+func NewProcessCollector(conf agentcfg.ProcessCollectorConfig) *ProcessCollector {
+	return &ProcessCollector{
+		names:    conf.Names,
+		pidFiles: conf.PIDFiles,
+		samples:  make(map[int32]cpuSample),
+
+		processes:  listProcesses,
+		newProcess: newProcess,
+		now:        time.Now,
+	}
+}
+
+// Name returns the name of the collector.
+func (*ProcessCollector) Name() string {
+	return "process"
+}
+
+// Collect returns CPU, RSS, open file descriptors and threads of the processes.
+// A process which is not running is reported with a zero ProcessCount.
+func (c *ProcessCollector) Collect(ctx context.Context) ([]*metric.Metric, error) {
+	targets, err := c.findProcesses(ctx)
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := c.now()
+	seen := make(map[int32]bool)
+	var metrics []*metric.Metric
+	for label, procs := range targets {
+		var stats processStats
+		for _, p := range procs {
+			seen[p.PID()] = true
+			c.addStats(ctx, p, now, &stats)
+		}
+
+		metrics = append(metrics,
+			metric.NewGauge(labeled("ProcessCount", label), float64(stats.count)),
+			metric.NewGauge(labeled("ProcessCPUPercent", label), stats.cpuPercent),
+			metric.NewGauge(labeled("ProcessRSS", label), float64(stats.rss)),
+			metric.NewGauge(labeled("ProcessOpenFDs", label), float64(stats.fds)),
+			metric.NewGauge(labeled("ProcessThreads", label), float64(stats.threads)),
+		)
+	}
+
+	for pid := range c.samples {
+		if !seen[pid] {
+			delete(c.samples, pid)
+		}
+	}
+
+	return metrics, err
+}
+
+// addStats adds the stats of the process, the ones which can not be read are skipped
+// as the process may exit in the middle of collection.
+func (c *ProcessCollector) addStats(ctx context.Context, p proc, now time.Time, stats *processStats) {
+	times, err := p.TimesWithContext(ctx)
+	if err != nil {
+		return
+	}
+	stats.count++
+
+	seconds := times.User + times.System
+	if prev, ok := c.samples[p.PID()]; ok && seconds >= prev.seconds && now.After(prev.at) {
+		stats.cpuPercent += 100 * (seconds - prev.seconds) / now.Sub(prev.at).Seconds()
+	}
+	c.samples[p.PID()] = cpuSample{seconds: seconds, at: now}
+
+	if mem, err := p.MemoryInfoWithContext(ctx); err == nil {
+		stats.rss += mem.RSS
+	}
+	if fds, err := p.NumFDsWithContext(ctx); err == nil {
+		stats.fds += fds
+	}
+	if threads, err := p.NumThreadsWithContext(ctx); err == nil {
+		stats.threads += threads
+	}
+}
+
+// findProcesses returns the running processes grouped by label.
+func (c *ProcessCollector) findProcesses(ctx context.Context) (map[string][]proc, error) {
+	targets := make(map[string][]proc)
+	var firstErr error
+
+	if len(c.names) > 0 {
+		for _, name := range c.names {
+			targets[name] = nil
+		}
+
+		procs, err := c.processes(ctx)
+		if err != nil {
+			firstErr = errors.Wrap(err, "failed to list processes")
+		}
+		for _, p := range procs {
+			name, err := p.NameWithContext(ctx)
+			if err != nil {
+				continue
+			}
+			if _, ok := targets[name]; ok {
+				targets[name] = append(targets[name], p)
+			}
+		}
+	}
+
+	for _, pidFile := range c.pidFiles {
+		label := strings.TrimSuffix(filepath.Base(pidFile), ".pid")
+		targets[label] = nil
+
+		p, err := c.processFromPIDFile(ctx, pidFile)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		targets[label] = append(targets[label], p)
+	}
+
+	return targets, firstErr
+}
+
+func (c *ProcessCollector) processFromPIDFile(ctx context.Context, pidFile string) (proc, error) {
+	content, err := os.ReadFile(pidFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read PID file %s", pidFile)
+	}
+
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "incorrect PID in file %s", pidFile)
+	}
+
+	p, err := c.newProcess(ctx, int32(pid))
+	if err != nil {
+		return nil, errors.Wrapf(err, "process from PID file %s is not running", pidFile)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+type fakeProc struct {
+	pid        int32
+	name       string
+	cpuSeconds float64
+	rss        uint64
+	fds        int32
+	threads    int32
+}
+
+func (p *fakeProc) PID() int32 { return p.pid }
+
+func (p *fakeProc) NameWithContext(context.Context) (string, error) { return p.name, nil }
+
+func (p *fakeProc) TimesWithContext(context.Context) (*cpu.TimesStat, error) {
+	return &cpu.TimesStat{User: p.cpuSeconds / 2, System: p.cpuSeconds / 2}, nil
+}
+
+func (p *fakeProc) MemoryInfoWithContext(context.Context) (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: p.rss}, nil
+}
+
+func (p *fakeProc) NumFDsWithContext(context.Context) (int32, error) { return p.fds, nil }
+
+func (p *fakeProc) NumThreadsWithContext(context.Context) (int32, error) { return p.threads, nil }
+
+func TestProcessCollector_Collect(t *testing.T) {
+	nginx1 := &fakeProc{pid: 10, name: "nginx", cpuSeconds: 1, rss: 100, fds: 5, threads: 1}
+	nginx2 := &fakeProc{pid: 11, name: "nginx", cpuSeconds: 2, rss: 200, fds: 7, threads: 2}
+	postgres := &fakeProc{pid: 20, name: "postgres", cpuSeconds: 10, rss: 1000, fds: 50, threads: 4}
+	procs := map[int32]*fakeProc{10: nginx1, 11: nginx2, 20: postgres, 30: {pid: 30, name: "bash"}}
+
+	pidFile := filepath.Join(t.TempDir(), "db.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte("20\n"), 0600))
+
+	c := NewProcessCollector(agentcfg.ProcessCollectorConfig{
+		Names:    []string{"nginx", "redis"},
+		PIDFiles: []string{pidFile},
+	})
+	c.processes = func(context.Context) ([]proc, error) {
+		res := make([]proc, 0, len(procs))
+		for _, p := range procs {
+			res = append(res, p)
+		}
+		return res, nil
+	}
+	c.newProcess = func(_ context.Context, pid int32) (proc, error) {
+		if p, ok := procs[pid]; ok {
+			return p, nil
+		}
+		return nil, errors.New("process not found")
+	}
+	now := time.Unix(1_700_000_000, 0)
+	c.now = func() time.Time { return now }
+
+	metrics := collectByName(t, c)
+
+	tests := []struct {
+		name string
+		want *metric.Metric
+	}{
+		{name: "processes with the same name", want: metric.NewGauge("ProcessCount_nginx", 2)},
+		{name: "summed RSS", want: metric.NewGauge("ProcessRSS_nginx", 300)},
+		{name: "summed file descriptors", want: metric.NewGauge("ProcessOpenFDs_nginx", 12)},
+		{name: "summed threads", want: metric.NewGauge("ProcessThreads_nginx", 3)},
+		{name: "first observation of CPU", want: metric.NewGauge("ProcessCPUPercent_nginx", 0)},
+		{name: "process from PID file", want: metric.NewGauge("ProcessRSS_db", 1000)},
+		{name: "process which is not running", want: metric.NewGauge("ProcessCount_redis", 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, metrics[tt.want.Name()])
+		})
+	}
+	assert.NotContains(t, metrics, "ProcessCount_bash", "not watched")
+
+	// One CPU second of each nginx process in two seconds is 100%
+	nginx1.cpuSeconds, nginx2.cpuSeconds = 2, 3
+	now = now.Add(2 * time.Second)
+	metrics = collectByName(t, c)
+
+	assert.Equal(t, metric.NewGauge("ProcessCPUPercent_nginx", 100), metrics["ProcessCPUPercent_nginx"])
+	assert.Equal(t, metric.NewGauge("ProcessCPUPercent_db", 0), metrics["ProcessCPUPercent_db"])
+}
+
+func TestProcessCollector_CollectMissingPIDFile(t *testing.T) {
+	c := NewProcessCollector(agentcfg.ProcessCollectorConfig{
+		PIDFiles: []string{filepath.Join(t.TempDir(), "missing.pid")},
+	})
+
+	metrics, err := c.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, []*metric.Metric{
+		metric.NewGauge("ProcessCount_missing", 0),
+		metric.NewGauge("ProcessCPUPercent_missing", 0),
+		metric.NewGauge("ProcessRSS_missing", 0),
+		metric.NewGauge("ProcessOpenFDs_missing", 0),
+		metric.NewGauge("ProcessThreads_missing", 0),
+	}, metrics)
+}
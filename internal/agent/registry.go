@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage"
+)
+
+type registration struct {
+	collector Collector
+	interval  time.Duration
+	timeout   time.Duration
+}
+
+// Registry runs the registered collectors, each one on its own interval,
+// and puts the collected metrics into the storage.
+type Registry struct {
+	pollInterval  time.Duration
+	hostID        string
+	rules         *Rules
+	store         storage.Storage
+	registrations []registration
+	logger        zerolog.Logger
+}
+
+// NewRegistry instantiates a new Registry.
+// The pollInterval is used for the collectors which do not define their own.
+// The rules are applied to the collected metrics before storing them. If hostID is
+// not empty, it is attached to every metric, so the metrics of different hosts are
+// not mixed up on the server.
+func NewRegistry(
+	pollInterval time.Duration,
+	hostID string,
+	rules *Rules,
+	store storage.Storage,
+	logService *loggerservice.LoggerService,
+) *Registry {
+	return &Registry{
+		pollInterval: pollInterval,
+		hostID:       hostID,
+		rules:        rules,
+		store:        store,
+		logger:       logService.ComponentLogger("Collectors"),
+	}
+}
+
+// Register adds the collector if it is enabled in the configuration.
+func (r *Registry) Register(conf agentcfg.CollectorConfig, c Collector) {
+	if !conf.Enabled {
+		return
+	}
+
+	interval := conf.PollInterval
+	if interval == 0 {
+		interval = r.pollInterval
+	}
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = interval
+	}
+
+	r.registrations = append(r.registrations, registration{
+		collector: c,
+		interval:  interval,
+		timeout:   timeout,
+	})
+	r.logger.Info().Msgf("collector %s is registered with interval %s", c.Name(), interval)
+}
+
+// Run runs the collectors until the context is done.
+func (r *Registry) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, reg := range r.registrations {
+		wg.Add(1)
+		go func(reg registration) {
+			defer wg.Done()
+			r.run(ctx, reg)
+		}(reg)
+	}
+	wg.Wait()
+}
+
+func (r *Registry) run(ctx context.Context, reg registration) {
+	ticker := time.NewTicker(reg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.collect(ctx, reg)
+		}
+	}
+}
+
+func (r *Registry) collect(ctx context.Context, reg registration) {
+	name := reg.collector.Name()
+	ctx, cancel := context.WithTimeout(ctx, reg.timeout)
+	defer cancel()
+
+	metrics, err := collectSafely(ctx, reg.collector)
+	if err != nil {
+		r.logger.Error().Err(err).Msgf("collector %s failed", name)
+	}
+
+	for _, m := range r.rules.Apply(metrics) {
+		if r.hostID != "" {
+			m.ID = labeled(m.ID, r.hostID)
+		}
+		if _, err := r.store.Update(ctx, m); err != nil {
+			r.logger.Error().Err(err).Msgf("collector %s: failed to update metric %v", name, m)
+		}
+	}
+}
+
+type collectResult struct {
+	metrics []*metric.Metric
+	err     error
+}
+
+// collectSafely isolates the collector: a panic is turned into an error and
+// a collector which does not respect the context does not block the caller.
+func collectSafely(ctx context.Context, c Collector) ([]*metric.Metric, error) {
+	res := make(chan collectResult, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				res <- collectResult{err: fmt.Errorf("collector panicked: %v", p)}
+			}
+		}()
+
+		metrics, err := c.Collect(ctx)
+		res <- collectResult{metrics: metrics, err: err}
+	}()
+
+	select {
+	case r := <-res:
+		return r.metrics, r.err
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "collection is timed out")
+	}
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage/memstorage"
+)
+
+type funcCollector func(ctx context.Context) ([]*metric.Metric, error)
+
+func (funcCollector) Name() string {
+	return "func"
+}
+
+func (f funcCollector) Collect(ctx context.Context) ([]*metric.Metric, error) {
+	return f(ctx)
+}
+
+func Test_collectSafely(t *testing.T) {
+	tests := []struct {
+		name        string
+		collector   funcCollector
+		wantMetrics int
+		wantErr     bool
+	}{
+		{
+			name: "success",
+			collector: func(context.Context) ([]*metric.Metric, error) {
+				return []*metric.Metric{metric.NewGauge("g", 1)}, nil
+			},
+			wantMetrics: 1,
+			wantErr:     false,
+		},
+		{
+			name: "panic",
+			collector: func(context.Context) ([]*metric.Metric, error) {
+				panic("boom")
+			},
+			wantMetrics: 0,
+			wantErr:     true,
+		},
+		{
+			name: "ignores timeout",
+			collector: func(context.Context) ([]*metric.Metric, error) {
+				time.Sleep(time.Second)
+				return []*metric.Metric{metric.NewGauge("g", 1)}, nil
+			},
+			wantMetrics: 0,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			metrics, err := collectSafely(ctx, tt.collector)
+			assert.Len(t, metrics, tt.wantMetrics)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestRegistry_collectHostID(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostID   string
+		wantName string
+	}{
+		{name: "tagged with the host", hostID: "web-1", wantName: "Alloc_web-1"},
+		{name: "host is sanitized", hostID: "web 1.local", wantName: "Alloc_web_1.local"},
+		{name: "not tagged", hostID: "", wantName: "Alloc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logService := loggerservice.New()
+			rules, err := NewRules(agentcfg.FilterConfig{}, logService)
+			require.NoError(t, err)
+			store := memstorage.NewMemStorage("", logService)
+
+			r := NewRegistry(time.Second, tt.hostID, rules, store, logService)
+			r.collect(context.Background(), registration{
+				collector: funcCollector(func(context.Context) ([]*metric.Metric, error) {
+					return []*metric.Metric{metric.NewGauge("Alloc", 1)}, nil
+				}),
+				timeout: time.Second,
+			})
+
+			metrics := store.All(context.Background())
+			require.Len(t, metrics, 1)
+			assert.Equal(t, tt.wantName, metrics[0].Name())
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+type relabelRule struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+// Rules filters and renames the collected metrics before they are stored.
+type Rules struct {
+	allow   []*regexp.Regexp
+	deny    []*regexp.Regexp
+	relabel []relabelRule
+	dryRun  bool
+	logger  zerolog.Logger
+
+	// The same metrics are collected on every poll, so each of them is logged once
+	mx     sync.Mutex
+	logged map[string]bool
+	// sources maps the resulting names to the collected ones to detect collisions
+	sources map[string]string
+}
+
+// NewRules compiles the rules from the configuration.
+func NewRules(conf agentcfg.FilterConfig, logService *loggerservice.LoggerService) (*Rules, error) {
+	allow, err := compileAll(conf.Allow)
+	if err != nil {
+		return nil, errors.Wrap(err, "incorrect allow rule")
+	}
+
+	deny, err := compileAll(conf.Deny)
+	if err != nil {
+		return nil, errors.Wrap(err, "incorrect deny rule")
+	}
+
+	relabel := make([]relabelRule, 0, len(conf.Relabel))
+	for _, rule := range conf.Relabel {
+		match, err := compile(rule.Match)
+		if err != nil {
+			return nil, errors.Wrap(err, "incorrect relabel rule")
+		}
+		relabel = append(relabel, relabelRule{match: match, replace: rule.Replace})
+	}
+
+	return &Rules{
+		allow:   allow,
+		deny:    deny,
+		relabel: relabel,
+		dryRun:  conf.DryRun,
+		logger:  logService.ComponentLogger("Rules"),
+		logged:  make(map[string]bool),
+		sources: make(map[string]string),
+	}, nil
+}
+
+// Apply returns the metrics which passed the filters, renamed by the relabel rules.
+// The metrics renamed to an empty name are dropped. In the dry-run mode the metrics
+// are returned unchanged.
+func (r *Rules) Apply(metrics []*metric.Metric) []*metric.Metric {
+	if r == nil {
+		return metrics
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	res := make([]*metric.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if !r.allowed(m.Name()) {
+			if r.dryRun {
+				r.logOnce(zerolog.InfoLevel, "dry run: metric %s would be dropped", m.Name())
+				res = append(res, m)
+			}
+			continue
+		}
+
+		name := r.rename(m.Name())
+		if name == "" {
+			if r.dryRun {
+				r.logOnce(zerolog.InfoLevel, "dry run: metric %s would be dropped as renamed to an empty name", m.Name())
+				res = append(res, m)
+			} else {
+				r.logOnce(zerolog.WarnLevel, "metric %s is dropped as renamed to an empty name", m.Name())
+			}
+			continue
+		}
+
+		r.checkCollision(m.MType, m.Name(), name)
+		if name != m.Name() {
+			if r.dryRun {
+				r.logOnce(zerolog.InfoLevel, "dry run: metric %s would be renamed to %s", m.Name(), name)
+			} else {
+				m.ID = name
+			}
+		}
+		res = append(res, m)
+	}
+
+	return res
+}
+
+// checkCollision logs the metrics renamed to the name of another metric,
+// their values would overwrite each other.
+func (r *Rules) checkCollision(metricType metric.Type, source string, name string) {
+	key := string(metricType) + ":" + name
+	other, ok := r.sources[key]
+	if !ok {
+		r.sources[key] = source
+		return
+	}
+	if other != source {
+		r.logOnce(zerolog.WarnLevel, "metrics %s and %s are both stored as %s", other, source, name)
+	}
+}
+
+// logOnce logs the message unless it was logged before.
+func (r *Rules) logOnce(level zerolog.Level, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if r.logged[msg] {
+		return
+	}
+	r.logged[msg] = true
+	r.logger.WithLevel(level).Msg(msg)
+}
+
+func (r *Rules) allowed(name string) bool {
+	if len(r.allow) > 0 && !matchAnyRegexp(r.allow, name) {
+		return false
+	}
+	return !matchAnyRegexp(r.deny, name)
+}
+
+func (r *Rules) rename(name string) string {
+	for _, rule := range r.relabel {
+		if rule.match.MatchString(name) {
+			name = rule.match.ReplaceAllString(name, rule.replace)
+		}
+	}
+	return name
+}
+
+func matchAnyRegexp(exprs []*regexp.Regexp, name string) bool {
+	for _, expr := range exprs {
+		if expr.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// compile compiles the expression matching the whole name.
+func compile(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(fmt.Sprintf("^(?:%s)$", expr))
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/config/agentcfg"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+func TestRules_Apply(t *testing.T) {
+	collected := func() []*metric.Metric {
+		return []*metric.Metric{
+			metric.NewGauge("Alloc", 1),
+			metric.NewGauge("HeapAlloc", 2),
+			metric.NewGauge("CPUutilization0", 3),
+			metric.NewGauge("CPUutilization1", 4),
+			metric.NewCounter("PollCount", 5),
+		}
+	}
+
+	tests := []struct {
+		name string
+		conf agentcfg.FilterConfig
+		want []string
+	}{
+		{
+			name: "no rules",
+			conf: agentcfg.FilterConfig{},
+			want: []string{"Alloc", "HeapAlloc", "CPUutilization0", "CPUutilization1", "PollCount"},
+		},
+		{
+			name: "allow",
+			conf: agentcfg.FilterConfig{Allow: []string{"CPU.*", "PollCount"}},
+			want: []string{"CPUutilization0", "CPUutilization1", "PollCount"},
+		},
+		{
+			name: "deny matches the whole name",
+			conf: agentcfg.FilterConfig{Deny: []string{"Alloc", "CPUutilization[1-9]"}},
+			want: []string{"HeapAlloc", "CPUutilization0", "PollCount"},
+		},
+		{
+			name: "relabel after filtering",
+			conf: agentcfg.FilterConfig{
+				Deny: []string{"CPUutilization1"},
+				Relabel: []agentcfg.RelabelRule{
+					{Match: "CPUutilization(\\d+)", Replace: "cpu_${1}_percent"},
+					{Match: "PollCount", Replace: "Polls"},
+				},
+			},
+			want: []string{"Alloc", "HeapAlloc", "cpu_0_percent", "Polls"},
+		},
+		{
+			name: "dry run",
+			conf: agentcfg.FilterConfig{
+				Deny:    []string{"Alloc"},
+				Relabel: []agentcfg.RelabelRule{{Match: "PollCount", Replace: "Polls"}},
+				DryRun:  true,
+			},
+			want: []string{"Alloc", "HeapAlloc", "CPUutilization0", "CPUutilization1", "PollCount"},
+		},
+		{
+			name: "renamed to an empty name",
+			conf: agentcfg.FilterConfig{
+				Relabel: []agentcfg.RelabelRule{{Match: "CPUutilization\\d+", Replace: ""}},
+			},
+			want: []string{"Alloc", "HeapAlloc", "PollCount"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := NewRules(tt.conf, loggerservice.New())
+			require.NoError(t, err)
+
+			var got []string
+			for _, m := range rules.Apply(collected()) {
+				got = append(got, m.Name())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewRules_IncorrectExpression(t *testing.T) {
+	_, err := NewRules(agentcfg.FilterConfig{Deny: []string{"("}}, loggerservice.New())
+	assert.Error(t, err)
+}
+
+func TestRules_ApplyLogsOnce(t *testing.T) {
+	rules, err := NewRules(agentcfg.FilterConfig{
+		Deny: []string{"Alloc"},
+		Relabel: []agentcfg.RelabelRule{
+			{Match: "HeapAlloc", Replace: "TotalAlloc"},
+			{Match: "PollCount", Replace: "Polls"},
+		},
+		DryRun: true,
+	}, loggerservice.New())
+	require.NoError(t, err)
+	var logs bytes.Buffer
+	rules.logger = zerolog.New(&logs)
+
+	collected := func() []*metric.Metric {
+		return []*metric.Metric{
+			metric.NewGauge("Alloc", 1),
+			metric.NewGauge("HeapAlloc", 2),
+			metric.NewGauge("TotalAlloc", 3),
+			metric.NewCounter("PollCount", 4),
+		}
+	}
+	for i := 0; i < 3; i++ {
+		rules.Apply(collected())
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "metric Alloc would be dropped")
+	assert.Contains(t, lines[1], "metric HeapAlloc would be renamed to TotalAlloc")
+	assert.Contains(t, lines[2], "metrics HeapAlloc and TotalAlloc are both stored as TotalAlloc")
+	assert.Contains(t, lines[3], "metric PollCount would be renamed to Polls")
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// RuntimeCollector collects the memory statistics of the Go runtime.
+type RuntimeCollector struct{}
+
+var _ Collector = (*RuntimeCollector)(nil)
+
+// NewRuntimeCollector instantiates a new RuntimeCollector.
+func NewRuntimeCollector() *RuntimeCollector {
+	return &RuntimeCollector{}
+}
+
+// Name returns the name of the collector.
+func (*RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+// Collect returns the runtime memory statistics.
+func (*RuntimeCollector) Collect(_ context.Context) ([]*metric.Metric, error) {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+
+	return []*metric.Metric{
+		metric.NewGauge("Alloc", float64(memStats.Alloc)),
+		metric.NewGauge("BuckHashSys", float64(memStats.BuckHashSys)),
+		metric.NewGauge("Frees", float64(memStats.Frees)),
+		metric.NewGauge("GCCPUFraction", float64(memStats.GCCPUFraction)),
+		metric.NewGauge("GCSys", float64(memStats.GCSys)),
+		metric.NewGauge("HeapAlloc", float64(memStats.HeapAlloc)),
+		metric.NewGauge("HeapIdle", float64(memStats.HeapIdle)),
+		metric.NewGauge("HeapInuse", float64(memStats.HeapInuse)),
+		metric.NewGauge("HeapObjects", float64(memStats.HeapObjects)),
+		metric.NewGauge("HeapReleased", float64(memStats.HeapReleased)),
+		metric.NewGauge("HeapSys", float64(memStats.HeapSys)),
+		metric.NewGauge("LastGC", float64(memStats.LastGC)),
+		metric.NewGauge("Lookups", float64(memStats.Lookups)),
+		metric.NewGauge("MCacheInuse", float64(memStats.MCacheInuse)),
+		metric.NewGauge("MCacheSys", float64(memStats.MCacheSys)),
+		metric.NewGauge("MSpanInuse", float64(memStats.MSpanInuse)),
+		metric.NewGauge("MSpanSys", float64(memStats.MSpanSys)),
+		metric.NewGauge("Mallocs", float64(memStats.Mallocs)),
+		metric.NewGauge("NextGC", float64(memStats.NextGC)),
+		metric.NewGauge("NumForcedGC", float64(memStats.NumForcedGC)),
+		metric.NewGauge("NumGC", float64(memStats.NumGC)),
+		metric.NewGauge("OtherSys", float64(memStats.OtherSys)),
+		metric.NewGauge("PauseTotalNs", float64(memStats.PauseTotalNs)),
+		metric.NewGauge("StackInuse", float64(memStats.StackInuse)),
+		metric.NewGauge("StackSys", float64(memStats.StackSys)),
+		metric.NewGauge("Sys", float64(memStats.Sys)),
+		metric.NewGauge("TotalAlloc", float64(memStats.TotalAlloc)),
+
+		metric.NewCounter("PollCount", 1),
+		metric.NewGauge("RandomValue", float64(rand.Int())),
+	}, nil
+}
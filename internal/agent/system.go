@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// SystemCollector collects the memory and CPU utilization of the host.
+type SystemCollector struct{}
+
+var _ Collector = (*SystemCollector)(nil)
+
+// NewSystemCollector instantiates a new SystemCollector.
+func NewSystemCollector() *SystemCollector {
+	return &SystemCollector{}
+}
+
+// Name returns the name of the collector.
+func (*SystemCollector) Name() string {
+	return "system"
+}
+
+// Collect returns the memory and CPU utilization.
+func (*SystemCollector) Collect(ctx context.Context) ([]*metric.Metric, error) {
+	gopsutilMemory, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read virtual memory stats")
+	}
+
+	metrics := []*metric.Metric{
+		metric.NewGauge("TotalMemory", float64(gopsutilMemory.Total)),
+		metric.NewGauge("FreeMemory", float64(gopsutilMemory.Free)),
+	}
+
+	cpus, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return metrics, errors.Wrap(err, "failed to read get the number of cores")
+	}
+
+	for idx, cpuUsage := range cpus {
+		metrics = append(metrics, metric.NewGauge(fmt.Sprintf("CPUutilization%d", idx), cpuUsage))
+	}
+
+	return metrics, nil
+}
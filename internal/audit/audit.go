@@ -0,0 +1,140 @@
+// Package audit records the administrative and destructive operations.
+package audit
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/auth"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+// Outcome is the result of an operation.
+type Outcome string
+
+const (
+	// OutcomeSuccess is an operation which was done.
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure is an operation which was attempted but failed.
+	OutcomeFailure Outcome = "failure"
+)
+
+const (
+	// DefaultLimit is the number of entries returned if the filter has no limit.
+	DefaultLimit = 100
+	// MaxLimit is the maximum number of entries returned at once.
+	MaxLimit = 1000
+)
+
+// Entry is a record of the audit log: who did what and when.
+type Entry struct {
+	ID   int64     `db:"id" json:"id"`
+	Time time.Time `db:"time" json:"time"`
+	// Actor is the ID of the token, empty if the authentication is disabled.
+	Actor string `db:"actor" json:"actor"`
+	// IP is the address of the client, either of the TCP peer or reported by a trusted proxy.
+	IP string `db:"ip" json:"ip"`
+	// Action is the name of the operation, e.g. token.create.
+	Action string `db:"action" json:"action"`
+	// Target is the ID of the object of the operation.
+	Target  string  `db:"target" json:"target"`
+	Outcome Outcome `db:"outcome" json:"outcome"`
+	Details string  `db:"details" json:"details,omitempty"`
+}
+
+// Filter selects the entries, the empty fields match everything.
+type Filter struct {
+	Actor  string
+	Action string
+	Since  time.Time
+	Until  time.Time
+	// Limit is the maximum number of the newest entries, DefaultLimit if zero.
+	Limit int
+}
+
+// Match reports whether the entry is selected by the filter, the limit is not checked.
+func (f Filter) Match(e *Entry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Size returns the number of entries to return.
+func (f Filter) Size() int {
+	if f.Limit <= 0 {
+		return DefaultLimit
+	}
+	if f.Limit > MaxLimit {
+		return MaxLimit
+	}
+	return f.Limit
+}
+
+// Store keeps the entries, it never modifies or deletes them.
+type Store interface {
+	// AppendAudit adds an entry and assigns its ID.
+	AppendAudit(ctx context.Context, entry *Entry) error
+	// AuditEntries returns the newest entries selected by the filter.
+	AuditEntries(ctx context.Context, filter Filter) ([]*Entry, error)
+}
+
+// Log writes the entries to the store.
+type Log struct {
+	store  Store
+	now    func() time.Time
+	logger zerolog.Logger
+}
+
+// NewLog instantiates a new Log.
+func NewLog(store Store, logService *loggerservice.LoggerService) *Log {
+	return &Log{
+		store:  store,
+		now:    time.Now,
+		logger: logService.ComponentLogger("Audit"),
+	}
+}
+
+// Record writes an entry on behalf of the token of the context. The failures
+// are logged, they do not fail the operation, which is already done by then.
+// A nil Log records nothing.
+func (l *Log) Record(ctx context.Context, ip net.IP, action, target string, outcome Outcome, details string) {
+	if l == nil {
+		return
+	}
+
+	entry := &Entry{
+		Time:    l.now().UTC(),
+		Action:  action,
+		Target:  target,
+		Outcome: outcome,
+		Details: details,
+	}
+	if token, ok := auth.FromContext(ctx); ok {
+		entry.Actor = token.ID
+	}
+	if ip != nil {
+		entry.IP = ip.String()
+	}
+
+	if err := l.store.AppendAudit(ctx, entry); err != nil {
+		l.logger.Error().Err(err).Msgf("failed to record %s of %q by %q", action, target, entry.Actor)
+	}
+}
+
+// Entries returns the newest entries selected by the filter.
+func (l *Log) Entries(ctx context.Context, filter Filter) ([]*Entry, error) {
+	return l.store.AuditEntries(ctx, filter)
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/auth"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+type memStore struct {
+	entries []*Entry
+}
+
+func (s *memStore) AppendAudit(_ context.Context, entry *Entry) error {
+	entry.ID = int64(len(s.entries) + 1)
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memStore) AuditEntries(_ context.Context, filter Filter) ([]*Entry, error) {
+	return s.entries, nil
+}
+
+func TestLog_Record(t *testing.T) {
+	store := &memStore{}
+	log := NewLog(store, loggerservice.New())
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	log.now = func() time.Time { return now }
+
+	ctx := auth.NewContext(context.Background(), &auth.Token{ID: "abc"})
+	log.Record(ctx, net.ParseIP("10.0.0.1"), "token.revoke", "def", OutcomeSuccess, "")
+	log.Record(context.Background(), nil, "token.create", "ghi", OutcomeFailure, "storage is down")
+
+	entries, err := log.Entries(context.Background(), Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, []*Entry{
+		{ID: 1, Time: now, Actor: "abc", IP: "10.0.0.1", Action: "token.revoke", Target: "def", Outcome: OutcomeSuccess},
+		{ID: 2, Time: now, Action: "token.create", Target: "ghi", Outcome: OutcomeFailure, Details: "storage is down"},
+	}, entries)
+
+	var nilLog *Log
+	nilLog.Record(ctx, nil, "token.revoke", "def", OutcomeSuccess, "")
+}
+
+func TestFilter_Match(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry := &Entry{Time: at, Actor: "abc", Action: "token.create"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty filter", filter: Filter{}, want: true},
+		{name: "same actor", filter: Filter{Actor: "abc"}, want: true},
+		{name: "other actor", filter: Filter{Actor: "def"}, want: false},
+		{name: "other action", filter: Filter{Action: "token.revoke"}, want: false},
+		{name: "since is inclusive", filter: Filter{Since: at}, want: true},
+		{name: "until is exclusive", filter: Filter{Until: at}, want: false},
+		{name: "within range", filter: Filter{Since: at.Add(-time.Hour), Until: at.Add(time.Hour)}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(entry))
+		})
+	}
+}
+
+func TestFilter_Size(t *testing.T) {
+	assert.Equal(t, DefaultLimit, Filter{}.Size())
+	assert.Equal(t, 5, Filter{Limit: 5}.Size())
+	assert.Equal(t, MaxLimit, Filter{Limit: MaxLimit + 1}.Size())
+}
@@ -0,0 +1,195 @@
+// Package auth implements the bearer token authentication with scoped permissions.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Scope is a permission granted to a token.
+type Scope string
+
+const (
+	// ScopeWrite allows updating metrics.
+	ScopeWrite Scope = "write"
+	// ScopeRead allows reading metrics.
+	ScopeRead Scope = "read"
+	// ScopeAdmin allows managing the service, it implies all the other scopes.
+	ScopeAdmin Scope = "admin"
+)
+
+var (
+	// ErrUnauthenticated is returned if the token is missing or unknown.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned if the token does not have the required scope.
+	ErrForbidden = errors.New("forbidden")
+	// ErrTokenNotFound is returned by the storages if there is no token with the ID.
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// Scopes is a list of scopes, stored in the database as a comma-separated string.
+type Scopes []Scope
+
+// ParseScopes validates the names of the scopes.
+func ParseScopes(names []string) (Scopes, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	scopes := make(Scopes, 0, len(names))
+	for _, name := range names {
+		scope := Scope(strings.TrimSpace(name))
+		switch scope {
+		case ScopeWrite, ScopeRead, ScopeAdmin:
+			scopes = append(scopes, scope)
+		default:
+			return nil, errors.Errorf("unknown scope %q", name)
+		}
+	}
+	return scopes, nil
+}
+
+// Has reports whether the scope is granted.
+func (s Scopes) Has(scope Scope) bool {
+	for _, granted := range s {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements driver.Valuer.
+func (s Scopes) Value() (driver.Value, error) {
+	names := make([]string, 0, len(s))
+	for _, scope := range s {
+		names = append(names, string(scope))
+	}
+	return strings.Join(names, ","), nil
+}
+
+// Scan implements sql.Scanner.
+func (s *Scopes) Scan(src interface{}) error {
+	var value string
+	switch v := src.(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return errors.Errorf("unable to scan scopes from %T", src)
+	}
+
+	*s = nil
+	for _, name := range strings.Split(value, ",") {
+		if name != "" {
+			*s = append(*s, Scope(name))
+		}
+	}
+	return nil
+}
+
+// Token is an API token. Only the hash of the secret is stored.
+type Token struct {
+	ID        string    `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Hash      string    `db:"hash" json:"hash"`
+	Scopes    Scopes    `db:"scopes" json:"scopes"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// NewToken generates a token, the secret is returned to be handed to the client once.
+func NewToken(name string, scopes Scopes) (*Token, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", errors.Wrap(err, "failed to generate token ID")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", errors.Wrap(err, "failed to generate token secret")
+	}
+
+	plain := base64.RawURLEncoding.EncodeToString(secret)
+	return &Token{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      Hash(plain),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}, plain, nil
+}
+
+// Hash returns the hash of the token secret.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenLookup finds the tokens by hash.
+type TokenLookup interface {
+	// TokenByHash returns a token by the hash of its secret.
+	TokenByHash(ctx context.Context, hash string) (*Token, bool)
+}
+
+// Authenticator checks the tokens of the requests.
+type Authenticator struct {
+	tokens        TokenLookup
+	bootstrapHash string
+}
+
+// NewAuthenticator creates an Authenticator. The bootstrap token is not stored
+// and has the admin scope, it is used to create the first tokens.
+func NewAuthenticator(tokens TokenLookup, bootstrapToken string) *Authenticator {
+	var bootstrapHash string
+	if bootstrapToken != "" {
+		bootstrapHash = Hash(bootstrapToken)
+	}
+
+	return &Authenticator{
+		tokens:        tokens,
+		bootstrapHash: bootstrapHash,
+	}
+}
+
+// Authorize returns the token if it exists and has the scope.
+func (a *Authenticator) Authorize(ctx context.Context, secret string, scope Scope) (*Token, error) {
+	if secret == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	hash := Hash(secret)
+	if a.bootstrapHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.bootstrapHash)) == 1 {
+		return &Token{ID: "bootstrap", Name: "bootstrap", Scopes: Scopes{ScopeAdmin}}, nil
+	}
+
+	token, ok := a.tokens.TokenByHash(ctx, hash)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if !token.Scopes.Has(scope) {
+		return nil, ErrForbidden
+	}
+	return token, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the token of the request.
+func NewContext(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, token)
+}
+
+// FromContext returns the token of the request if it was authenticated.
+func FromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(contextKey{}).(*Token)
+	return token, ok
+}
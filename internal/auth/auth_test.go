@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tokenMap map[string]*Token
+
+func (m tokenMap) TokenByHash(_ context.Context, hash string) (*Token, bool) {
+	token, ok := m[hash]
+	return token, ok
+}
+
+func TestAuthenticator_Authorize(t *testing.T) {
+	writer, writerSecret, err := NewToken("agent", Scopes{ScopeWrite})
+	require.NoError(t, err)
+	admin, adminSecret, err := NewToken("admin", Scopes{ScopeAdmin})
+	require.NoError(t, err)
+
+	authenticator := NewAuthenticator(tokenMap{writer.Hash: writer, admin.Hash: admin}, "bootstrap-secret")
+
+	tests := []struct {
+		name    string
+		secret  string
+		scope   Scope
+		wantID  string
+		wantErr error
+	}{
+		{
+			name:   "granted scope",
+			secret: writerSecret,
+			scope:  ScopeWrite,
+			wantID: writer.ID,
+		},
+		{
+			name:    "missing scope",
+			secret:  writerSecret,
+			scope:   ScopeRead,
+			wantErr: ErrForbidden,
+		},
+		{
+			name:   "admin implies every scope",
+			secret: adminSecret,
+			scope:  ScopeRead,
+			wantID: admin.ID,
+		},
+		{
+			name:   "bootstrap token",
+			secret: "bootstrap-secret",
+			scope:  ScopeAdmin,
+			wantID: "bootstrap",
+		},
+		{
+			name:    "unknown token",
+			secret:  "unknown",
+			scope:   ScopeWrite,
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			name:    "no token",
+			secret:  "",
+			scope:   ScopeWrite,
+			wantErr: ErrUnauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := authenticator.Authorize(context.Background(), tt.secret, tt.scope)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantID, token.ID)
+		})
+	}
+}
+
+func TestScopes_ValueScan(t *testing.T) {
+	scopes := Scopes{ScopeRead, ScopeWrite}
+	value, err := scopes.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "read,write", value)
+
+	var scanned Scopes
+	require.NoError(t, scanned.Scan([]byte("read,write")))
+	assert.Equal(t, scopes, scanned)
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"read", "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, Scopes{ScopeRead, ScopeAdmin}, scopes)
+
+	_, err = ParseScopes([]string{"root"})
+	assert.Error(t, err)
+
+	_, err = ParseScopes(nil)
+	assert.Error(t, err)
+}
@@ -4,12 +4,16 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v6"
+	"github.com/denistakeda/alerting/internal/retry"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
 )
 
 // Config is a configuration for agent
@@ -22,6 +26,167 @@ type Config struct {
 	Key            string        `env:"KEY" json:"key"`
 	RateLimit      int           `env:"RATE_LIMIT" json:"rate_limit"`
 	CryptoKey      string        `env:"CRYPTO_KEY" json:"crypto_key"`
+	EncryptionKey  string        `env:"ENCRYPTION_KEY" json:"encryption_key"`
+	ListenAddress  string        `env:"LISTEN_ADDRESS" json:"listen_address"`
+	// ListenToken is required from the server scraping the metrics, if set.
+	// The metrics are served in plain HTTP, so ListenAddress should only be
+	// reachable by the server, e.g. localhost or a private network.
+	ListenToken string `env:"LISTEN_TOKEN" json:"listen_token"`
+	// HostID is attached to the name of every metric, so the metrics of different
+	// hosts are not mixed up on the server. The names are left as is if empty.
+	HostID string `env:"HOST_ID" json:"host_id"`
+	// KeyID identifies Key on the server, so the keys can be rotated one agent at a time.
+	KeyID string `env:"KEY_ID" json:"key_id"`
+	// ReplayProtection stamps the metrics with a timestamp and a nonce, it should
+	// be enabled along with the replay protection of the server.
+	ReplayProtection bool `env:"REPLAY_PROTECTION" json:"replay_protection"`
+	// Token is the API token with the write scope.
+	Token string `env:"TOKEN" json:"token"`
+	// RealIP is sent in the X-Real-IP header, detected from the outbound interface if empty.
+	RealIP string `env:"REAL_IP" json:"real_ip"`
+	// GRPCTLSCA is a path to the CA certificate to verify the GRPC server, the
+	// connection is plaintext if empty. CryptoKey is only used for HTTP.
+	GRPCTLSCA string `env:"GRPC_TLS_CA" json:"grpc_tls_ca"`
+
+	// Destinations can only be set in the configuration file.
+	// If empty, the metrics are sent to Address or GRPCAddress.
+	Destinations []DestinationConfig `json:"destinations"`
+
+	SpoolDir     string `env:"SPOOL_DIR" json:"spool_dir"`
+	SpoolMaxSize int64  `env:"SPOOL_MAX_SIZE" json:"spool_max_size"`
+	SpoolPolicy  string `env:"SPOOL_POLICY" json:"spool_policy"`
+
+	RetryMaxAttempts int           `env:"RETRY_MAX_ATTEMPTS" json:"retry_max_attempts"`
+	RetryBaseDelay   time.Duration `env:"RETRY_BASE_DELAY" json:"retry_base_delay"`
+	RetryMaxDelay    time.Duration `env:"RETRY_MAX_DELAY" json:"retry_max_delay"`
+	RetryJitter      float64       `env:"RETRY_JITTER" json:"retry_jitter"`
+	RetryStatusCodes []int         `env:"RETRY_STATUS_CODES" envSeparator:"," json:"retry_status_codes"`
+	// RetryGRPCCodes are the names of the gRPC status codes to retry on, such as
+	// Unavailable. The metrics are only resent if the server has not received them.
+	RetryGRPCCodes []string `env:"RETRY_GRPC_CODES" envSeparator:"," json:"retry_grpc_codes"`
+
+	Collectors CollectorsConfig `envPrefix:"COLLECTOR_" json:"collectors"`
+	Filter     FilterConfig     `envPrefix:"FILTER_" json:"filter"`
+}
+
+// DestinationConfig is a server to send metrics to.
+// Either Address or GRPCAddress should be set.
+type DestinationConfig struct {
+	// Name distinguishes the destination in logs and in the spool directory.
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	GRPCAddress string `json:"grpc_address"`
+	Key         string `json:"key"`
+	// KeyID identifies Key on the server.
+	KeyID string `json:"key_id"`
+	// CryptoKey is a path to the CA certificate to verify the HTTP server.
+	CryptoKey string `json:"crypto_key"`
+	// GRPCTLSCA is a path to the CA certificate to verify the GRPC server,
+	// the connection is plaintext if empty.
+	GRPCTLSCA string `json:"grpc_tls_ca"`
+	// EncryptionKey is a path to the public key of the server to encrypt the payload.
+	EncryptionKey string `json:"encryption_key"`
+	// Token is the API token with the write scope.
+	Token     string `json:"token"`
+	RateLimit int    `json:"rate_limit"`
+}
+
+// RelabelRule renames the metrics which names match the regular expression.
+// The replacement can refer to the groups of the expression as $1, $2, etc.
+type RelabelRule struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// FilterConfig is a configuration of the rules applied to collected metrics.
+// The regular expressions should match the whole metric name.
+type FilterConfig struct {
+	// Allow keeps only the metrics matching any of the expressions, if set.
+	Allow []string `env:"ALLOW" envSeparator:"," json:"allow"`
+	// Deny drops the metrics matching any of the expressions.
+	Deny []string `env:"DENY" envSeparator:"," json:"deny"`
+	// Relabel rules are applied in order after filtering, can only be set in the configuration file.
+	Relabel []RelabelRule `json:"relabel"`
+	// DryRun only logs the metrics which would be dropped or renamed.
+	DryRun bool `env:"DRY_RUN" json:"dry_run"`
+}
+
+// CollectorConfig is a configuration of a single metrics collector.
+type CollectorConfig struct {
+	Enabled bool `env:"ENABLED" json:"enabled"`
+	// PollInterval overrides the agent poll interval if set.
+	PollInterval time.Duration `env:"POLL_INTERVAL" json:"poll_interval"`
+	// Timeout limits a single collection, defaults to the poll interval.
+	Timeout time.Duration `env:"TIMEOUT" json:"timeout"`
+}
+
+// DiskCollectorConfig is a configuration of the disk collector.
+// The filters are glob patterns.
+type DiskCollectorConfig struct {
+	CollectorConfig
+
+	IncludeMounts  []string `env:"INCLUDE_MOUNTS" envSeparator:"," json:"include_mounts"`
+	ExcludeMounts  []string `env:"EXCLUDE_MOUNTS" envSeparator:"," json:"exclude_mounts"`
+	IncludeFSTypes []string `env:"INCLUDE_FSTYPES" envSeparator:"," json:"include_fstypes"`
+	ExcludeFSTypes []string `env:"EXCLUDE_FSTYPES" envSeparator:"," json:"exclude_fstypes"`
+}
+
+// NetworkCollectorConfig is a configuration of the network collector.
+// The filters are glob patterns.
+type NetworkCollectorConfig struct {
+	CollectorConfig
+
+	IncludeInterfaces []string `env:"INCLUDE_INTERFACES" envSeparator:"," json:"include_interfaces"`
+	ExcludeInterfaces []string `env:"EXCLUDE_INTERFACES" envSeparator:"," json:"exclude_interfaces"`
+}
+
+// ProcessCollectorConfig is a configuration of the process collector.
+type ProcessCollectorConfig struct {
+	CollectorConfig
+
+	// Names are the names of the processes to watch.
+	Names []string `env:"NAMES" envSeparator:"," json:"names"`
+	// PIDFiles are the paths to the files with PIDs of the processes to watch.
+	PIDFiles []string `env:"PID_FILES" envSeparator:"," json:"pid_files"`
+}
+
+// CgroupCollectorConfig is a configuration of the cgroup v2 collector.
+type CgroupCollectorConfig struct {
+	CollectorConfig
+
+	// Root is the directory of the cgroup to watch.
+	Root string `env:"ROOT" json:"root"`
+}
+
+// ExecCommandConfig is a command run by the exec collector.
+type ExecCommandConfig struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+	// Format is the format of the command output: "json" or "lines".
+	Format string `json:"format"`
+	// Timeout overrides the timeout of the collector if set.
+	Timeout time.Duration `json:"timeout"`
+}
+
+// ExecCollectorConfig is a configuration of the exec collector.
+// The commands can only be set in the configuration file.
+type ExecCollectorConfig struct {
+	CollectorConfig
+
+	MaxConcurrency int                 `env:"MAX_CONCURRENCY" json:"max_concurrency"`
+	Commands       []ExecCommandConfig `json:"commands"`
+}
+
+// CollectorsConfig is a configuration of all the metrics collectors.
+type CollectorsConfig struct {
+	Runtime CollectorConfig        `envPrefix:"RUNTIME_" json:"runtime"`
+	System  CollectorConfig        `envPrefix:"SYSTEM_" json:"system"`
+	Disk    DiskCollectorConfig    `envPrefix:"DISK_" json:"disk"`
+	Network NetworkCollectorConfig `envPrefix:"NETWORK_" json:"network"`
+	Process ProcessCollectorConfig `envPrefix:"PROCESS_" json:"process"`
+	Host    CollectorConfig        `envPrefix:"HOST_" json:"host"`
+	Cgroup  CgroupCollectorConfig  `envPrefix:"CGROUP_" json:"cgroup"`
+	Exec    ExecCollectorConfig    `envPrefix:"EXEC_" json:"exec"`
 }
 
 // GetConfig extracts the configuration from environment variables and flags
@@ -32,6 +197,42 @@ func GetConfig() (Config, error) {
 		ReportInterval: 10 * time.Second,
 		PollInterval:   2 * time.Second,
 		RateLimit:      1,
+
+		SpoolMaxSize: 64 << 20,
+		SpoolPolicy:  "drop_oldest",
+
+		RetryMaxAttempts: 3,
+		RetryBaseDelay:   500 * time.Millisecond,
+		RetryMaxDelay:    5 * time.Second,
+		RetryJitter:      0.2,
+		RetryStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryGRPCCodes: []string{
+			codes.Unavailable.String(),
+			codes.ResourceExhausted.String(),
+			codes.Aborted.String(),
+		},
+
+		Collectors: CollectorsConfig{
+			Runtime: CollectorConfig{Enabled: true},
+			System:  CollectorConfig{Enabled: true},
+			Disk: DiskCollectorConfig{
+				ExcludeFSTypes: []string{"tmpfs", "devtmpfs", "overlay", "squashfs"},
+			},
+			Network: NetworkCollectorConfig{
+				ExcludeInterfaces: []string{"lo"},
+			},
+			Cgroup: CgroupCollectorConfig{
+				Root: "/sys/fs/cgroup",
+			},
+			Exec: ExecCollectorConfig{
+				MaxConcurrency: 4,
+			},
+		},
 	}
 
 	// Read from file
@@ -59,6 +260,35 @@ func GetConfig() (Config, error) {
 	flag.StringVar(&config.Key, "k", config.Key, "Key to sign")
 	flag.IntVar(&config.RateLimit, "l", config.RateLimit, "The maximum amount of active requests")
 	flag.StringVar(&config.CryptoKey, "c", config.CryptoKey, "Path to the certificate")
+	flag.StringVar(&config.EncryptionKey, "encryption-key", config.EncryptionKey, "Path to the public key of the server to encrypt metrics")
+	flag.StringVar(&config.ListenAddress, "listen", config.ListenAddress, "Address to expose metrics for scraping, disabled if empty")
+	flag.StringVar(&config.ListenToken, "listen-token", config.ListenToken, "Bearer token required to scrape the exposed metrics")
+	flag.StringVar(&config.GRPCTLSCA, "grpc-tls-ca", config.GRPCTLSCA, "Path to the CA certificate to verify the GRPC server, plaintext if empty")
+	flag.StringVar(&config.KeyID, "key-id", config.KeyID, "ID of the hash key on the server")
+	flag.BoolVar(&config.ReplayProtection, "replay-protection", config.ReplayProtection, "Stamp metrics with a timestamp and a nonce")
+	flag.StringVar(&config.Token, "token", config.Token, "API token to authenticate on the server")
+	flag.StringVar(&config.RealIP, "real-ip", config.RealIP, "Address sent in the X-Real-IP header, detected automatically if empty")
+	flag.StringVar(&config.HostID, "host-id", config.HostID, "Host identifier attached to the name of every metric, nothing is attached if empty")
+	flag.StringVar(&config.SpoolDir, "spool-dir", config.SpoolDir, "Directory to keep metrics which failed to be sent")
+	flag.Int64Var(&config.SpoolMaxSize, "spool-max-size", config.SpoolMaxSize, "Maximum size of the spool in bytes, 0 means unlimited")
+	flag.StringVar(&config.SpoolPolicy, "spool-policy", config.SpoolPolicy, "What to drop when the spool is full: drop_oldest or drop_newest")
+	flag.IntVar(&config.RetryMaxAttempts, "retry-max-attempts", config.RetryMaxAttempts, "Maximum attempts to send metrics")
+	flag.DurationVar(&config.RetryBaseDelay, "retry-base-delay", config.RetryBaseDelay, "Delay after the first failed attempt")
+	flag.DurationVar(&config.RetryMaxDelay, "retry-max-delay", config.RetryMaxDelay, "Maximum delay between attempts")
+	flag.Float64Var(&config.RetryJitter, "retry-jitter", config.RetryJitter, "Randomized fraction of the delay between attempts")
+	flag.Var((*intsFlag)(&config.RetryStatusCodes), "retry-status-codes", "Comma-separated HTTP statuses to retry sending metrics on")
+	flag.Var((*stringsFlag)(&config.RetryGRPCCodes), "retry-grpc-codes", "Comma-separated gRPC status codes to retry sending metrics on")
+	collectorFlags("runtime", &config.Collectors.Runtime)
+	collectorFlags("system", &config.Collectors.System)
+	collectorFlags("disk", &config.Collectors.Disk.CollectorConfig)
+	collectorFlags("network", &config.Collectors.Network.CollectorConfig)
+	collectorFlags("process", &config.Collectors.Process.CollectorConfig)
+	collectorFlags("host", &config.Collectors.Host)
+	collectorFlags("cgroup", &config.Collectors.Cgroup.CollectorConfig)
+	flag.StringVar(&config.Collectors.Cgroup.Root, "collector-cgroup-root", config.Collectors.Cgroup.Root, "Directory of the cgroup to watch")
+	collectorFlags("exec", &config.Collectors.Exec.CollectorConfig)
+	flag.BoolVar(&config.Filter.DryRun, "filter-dry-run", config.Filter.DryRun, "Only log the metrics which would be dropped or renamed by filter rules")
+	flag.IntVar(&config.Collectors.Exec.MaxConcurrency, "collector-exec-concurrency", config.Collectors.Exec.MaxConcurrency, "The maximum amount of commands running at once")
 	flag.Parse()
 
 	// Populate data from the env variables
@@ -66,10 +296,192 @@ func GetConfig() (Config, error) {
 		return Config{}, errors.Wrap(err, "failed to parse agent configuration from the environment variables")
 	}
 
-	// Validation and post-processing
-	if !strings.HasPrefix(config.Address, "http") {
-		config.Address = fmt.Sprintf("http://%s", config.Address)
+	if err := config.validate(); err != nil {
+		return Config{}, err
 	}
 
 	return config, nil
 }
+
+// validate checks the configuration and fills in the defaults of the destinations.
+func (c *Config) validate() error {
+	c.Address = withScheme(c.Address)
+
+	for _, name := range c.RetryGRPCCodes {
+		if _, ok := grpcCode(name); !ok {
+			return errors.Errorf("unknown gRPC status code '%s'", name)
+		}
+	}
+
+	names := make(map[string]bool, len(c.Destinations))
+	for i := range c.Destinations {
+		dest := &c.Destinations[i]
+		if dest.Address == "" && dest.GRPCAddress == "" {
+			return errors.Errorf("destination %d should have an address", i)
+		}
+		if dest.Address != "" && dest.GRPCAddress != "" {
+			return errors.Errorf("destination %d should have either an address or a gRPC address", i)
+		}
+		if dest.Address != "" {
+			dest.Address = withScheme(dest.Address)
+		}
+		if dest.Name == "" {
+			dest.Name = fmt.Sprintf("destination%d", i)
+		}
+		if dest.RateLimit == 0 {
+			dest.RateLimit = c.RateLimit
+		}
+		// The name is the directory of the spool, so the destinations can't share it
+		if dest.Name == "." || dest.Name == ".." || strings.ContainsAny(dest.Name, `/\`) {
+			return errors.Errorf("destination name '%s' should be a single path segment", dest.Name)
+		}
+		if names[dest.Name] {
+			return errors.Errorf("destination name '%s' is not unique", dest.Name)
+		}
+		names[dest.Name] = true
+	}
+
+	return nil
+}
+
+func withScheme(address string) string {
+	if !strings.HasPrefix(address, "http") {
+		return fmt.Sprintf("http://%s", address)
+	}
+	return address
+}
+
+// AllDestinations returns the servers to send metrics to.
+func (c Config) AllDestinations() []DestinationConfig {
+	if len(c.Destinations) != 0 {
+		return c.Destinations
+	}
+
+	return []DestinationConfig{{
+		Address:       c.Address,
+		GRPCAddress:   c.GRPCAddress,
+		Key:           c.Key,
+		KeyID:         c.KeyID,
+		CryptoKey:     c.CryptoKey,
+		GRPCTLSCA:     c.GRPCTLSCA,
+		EncryptionKey: c.EncryptionKey,
+		Token:         c.Token,
+		RateLimit:     c.RateLimit,
+	}}
+}
+
+// intsFlag is a comma-separated list of integers.
+type intsFlag []int
+
+func (f *intsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	values := make([]string, 0, len(*f))
+	for _, v := range *f {
+		values = append(values, strconv.Itoa(v))
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *intsFlag) Set(value string) error {
+	var values []int
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := strconv.Atoi(item)
+		if err != nil {
+			return errors.Wrapf(err, "invalid integer %q", item)
+		}
+		values = append(values, v)
+	}
+	*f = values
+	return nil
+}
+
+// stringsFlag is a comma-separated list of strings.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	*f = values
+	return nil
+}
+
+func collectorFlags(name string, c *CollectorConfig) {
+	flag.BoolVar(&c.Enabled, "collector-"+name, c.Enabled, fmt.Sprintf("Enable %s metrics collector", name))
+	flag.DurationVar(&c.PollInterval, "collector-"+name+"-interval", c.PollInterval, fmt.Sprintf("Interval to collect %s metrics", name))
+	flag.DurationVar(&c.Timeout, "collector-"+name+"-timeout", c.Timeout, fmt.Sprintf("Timeout to collect %s metrics", name))
+}
+
+// RetryPolicy returns the policy to retry sending metrics.
+func (c Config) RetryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts: c.RetryMaxAttempts,
+		BaseDelay:   c.RetryBaseDelay,
+		MaxDelay:    c.RetryMaxDelay,
+		Jitter:      c.RetryJitter,
+	}
+}
+
+// redacted replaces the secrets in the logged configuration.
+const redacted = "REDACTED"
+
+// String formats the configuration with the secrets redacted, so it can be logged.
+func (c Config) String() string {
+	c.Key = redact(c.Key)
+	c.Token = redact(c.Token)
+	c.ListenToken = redact(c.ListenToken)
+	destinations := make([]DestinationConfig, len(c.Destinations))
+	for i, dest := range c.Destinations {
+		dest.Key = redact(dest.Key)
+		dest.Token = redact(dest.Token)
+		destinations[i] = dest
+	}
+	c.Destinations = destinations
+
+	// The methods are dropped, so the fields are formatted as is
+	type config Config
+	return fmt.Sprintf("%+v", config(c))
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// RetryGRPCStatusCodes returns the gRPC status codes to retry sending metrics on.
+func (c Config) RetryGRPCStatusCodes() []codes.Code {
+	result := make([]codes.Code, 0, len(c.RetryGRPCCodes))
+	for _, name := range c.RetryGRPCCodes {
+		if code, ok := grpcCode(name); ok {
+			result = append(result, code)
+		}
+	}
+	return result
+}
+
+// grpcCode looks up the status code by its name, the case is ignored.
+func grpcCode(name string) (codes.Code, bool) {
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if strings.EqualFold(code.String(), name) {
+			return code, true
+		}
+	}
+	return 0, false
+}
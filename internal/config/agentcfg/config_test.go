@@ -0,0 +1,148 @@
+package agentcfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestIntsFlag(t *testing.T) {
+	var codes []int
+	f := (*intsFlag)(&codes)
+
+	require.NoError(t, f.Set("429, 502,503"))
+	assert.Equal(t, []int{429, 502, 503}, codes)
+	assert.Equal(t, "429,502,503", f.String())
+
+	assert.Error(t, f.Set("429,bad"))
+}
+
+func TestConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    Config
+		want    []DestinationConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults of the destinations",
+			conf: Config{
+				RateLimit: 2,
+				Destinations: []DestinationConfig{
+					{Address: "localhost:8080"},
+					{Name: "backup", Address: "https://backup:8443", RateLimit: 5},
+					{GRPCAddress: "localhost:3200", GRPCTLSCA: "ca.pem"},
+				},
+			},
+			want: []DestinationConfig{
+				{Name: "destination0", Address: "http://localhost:8080", RateLimit: 2},
+				{Name: "backup", Address: "https://backup:8443", RateLimit: 5},
+				{Name: "destination2", GRPCAddress: "localhost:3200", GRPCTLSCA: "ca.pem", RateLimit: 2},
+			},
+		},
+		{
+			name: "destination without address",
+			conf: Config{
+				Destinations: []DestinationConfig{{Name: "empty"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicated names",
+			conf: Config{
+				Destinations: []DestinationConfig{
+					{Name: "main", Address: "localhost:8080"},
+					{Name: "main", Address: "localhost:8081"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "both addresses",
+			conf: Config{
+				Destinations: []DestinationConfig{{Address: "localhost:8080", GRPCAddress: "localhost:3200"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "name outside of the spool directory",
+			conf: Config{
+				Destinations: []DestinationConfig{{Name: "../main", Address: "localhost:8080"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "parent directory as a name",
+			conf: Config{
+				Destinations: []DestinationConfig{{Name: "..", Address: "localhost:8080"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown gRPC code",
+			conf:    Config{RetryGRPCCodes: []string{"Unavailable", "Unknown503"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tt.conf.Destinations)
+		})
+	}
+}
+
+func TestConfig_RetryGRPCStatusCodes(t *testing.T) {
+	conf := Config{RetryGRPCCodes: []string{"Unavailable", "resourceexhausted"}}
+
+	require.NoError(t, conf.validate())
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.ResourceExhausted}, conf.RetryGRPCStatusCodes())
+}
+
+func TestConfig_AllDestinations(t *testing.T) {
+	conf := Config{
+		Address:     "http://localhost:8080",
+		GRPCAddress: "localhost:3200",
+		CryptoKey:   "https-ca.pem",
+		GRPCTLSCA:   "grpc-ca.pem",
+		Token:       "secret",
+		RateLimit:   3,
+	}
+
+	assert.Equal(t, []DestinationConfig{{
+		Address:     "http://localhost:8080",
+		GRPCAddress: "localhost:3200",
+		CryptoKey:   "https-ca.pem",
+		GRPCTLSCA:   "grpc-ca.pem",
+		Token:       "secret",
+		RateLimit:   3,
+	}}, conf.AllDestinations())
+
+	conf.Destinations = []DestinationConfig{{Name: "main", Address: "http://main:8080"}}
+	assert.Equal(t, conf.Destinations, conf.AllDestinations())
+}
+
+func TestConfig_String(t *testing.T) {
+	conf := Config{
+		Address:     "http://localhost:8080",
+		Key:         "hash-secret",
+		Token:       "token-secret",
+		ListenToken: "listen-secret",
+		Destinations: []DestinationConfig{
+			{Name: "backup", Key: "backup-secret", Token: "backup-token-secret"},
+		},
+	}
+
+	s := conf.String()
+	assert.Contains(t, s, "http://localhost:8080")
+	assert.Contains(t, s, "backup")
+	assert.NotContains(t, s, "secret")
+	assert.Equal(t, "backup-secret", conf.Destinations[0].Key)
+}
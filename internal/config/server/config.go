@@ -3,11 +3,13 @@ package servercfg
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"time"
 
 	"github.com/caarlos0/env/v6"
+	"github.com/denistakeda/alerting/internal/metric"
 	"github.com/pkg/errors"
 )
 
@@ -24,6 +26,50 @@ type Config struct {
 	Certificate   string        `env:"CERTIFICATE" json:"certificate"`
 	CryptoKey     string        `env:"CRYPTO_KEY" json:"crypto_key"`
 	TrustedSubnet string        `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
+	EncryptionKey string        `env:"ENCRYPTION_KEY" json:"encryption_key"`
+
+	// TrustedSubnets are the IPv4 or IPv6 CIDRs allowed to access every route group,
+	// unless AccessPolicy says otherwise. TrustedSubnet is added to them.
+	TrustedSubnets []string `env:"TRUSTED_SUBNETS" envSeparator:"," json:"trusted_subnets"`
+	// AccessPolicy maps the route groups (ingest, read, admin, health) to the allowed networks,
+	// an empty list makes the group open to everyone. It can only be set in the configuration file.
+	AccessPolicy map[string][]string `json:"access_policy"`
+	// Keys are the additional keys to verify the metrics, selected by the key ID
+	// of a metric. They can only be set in the configuration file.
+	Keys []metric.Key `json:"keys"`
+	// ReplayWindow is the allowed clock skew of the stamped metrics, the replay
+	// protection is disabled if zero. The /update/:type/:name/:value route can't
+	// carry the stamps, so it is rejected while the protection is enabled.
+	ReplayWindow time.Duration `env:"REPLAY_WINDOW" json:"replay_window"`
+	// ReplayCacheSize is the maximum number of remembered nonces, the stamped metrics
+	// are rejected with 503 while it is full.
+	ReplayCacheSize int `env:"REPLAY_CACHE_SIZE" json:"replay_cache_size"`
+	// IngestRequestRate and IngestMetricRate are the requests and metrics per second
+	// allowed to every client, told apart by the token or the address. Zero is unlimited.
+	IngestRequestRate  float64 `env:"INGEST_REQUEST_RATE" json:"ingest_request_rate"`
+	IngestRequestBurst int     `env:"INGEST_REQUEST_BURST" json:"ingest_request_burst"`
+	IngestMetricRate   float64 `env:"INGEST_METRIC_RATE" json:"ingest_metric_rate"`
+	IngestMetricBurst  int     `env:"INGEST_METRIC_BURST" json:"ingest_metric_burst"`
+	// MaxSeries is the number of distinct series the storage accepts, unlimited if zero.
+	MaxSeries int `env:"MAX_SERIES" json:"max_series"`
+	// SeriesLimits maps the name prefixes to the number of distinct series with that prefix.
+	// It can only be set in the configuration file.
+	SeriesLimits map[string]int `json:"series_limits"`
+	// AdminToken is a bootstrap token with the admin scope, setting it enables the token authentication.
+	AdminToken string `env:"ADMIN_TOKEN" json:"admin_token"`
+	// TrustedProxies are the addresses or CIDRs of proxies whose X-Real-IP and X-Forwarded-For
+	// headers are honored. The address of the TCP peer is used for the other clients.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:"," json:"trusted_proxies"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" json:"shutdown_timeout"`
+	// StorageCloseTimeout is the own budget of the final flush of the storage,
+	// so a long drain of the servers does not skip it.
+	StorageCloseTimeout time.Duration `env:"STORAGE_CLOSE_TIMEOUT" json:"storage_close_timeout"`
+
+	ScrapeTargets  []string      `env:"SCRAPE_TARGETS" envSeparator:"," json:"scrape_targets"`
+	ScrapeInterval time.Duration `env:"SCRAPE_INTERVAL" json:"scrape_interval"`
+	// ScrapeToken is sent to the agents as a bearer token, it should match their listen token.
+	ScrapeToken string `env:"SCRAPE_TOKEN" json:"scrape_token"`
 }
 
 // GetConfig extracts the configuration from environment variables and flags
@@ -35,6 +81,11 @@ func GetConfig() (Config, error) {
 		StoreInterval: 300 * time.Second,
 		StoreFile:     "/tmp/devops-metrics-db.json",
 		Restore:       true,
+
+		ShutdownTimeout:     5 * time.Second,
+		StorageCloseTimeout: 5 * time.Second,
+		ScrapeInterval:      10 * time.Second,
+		ReplayCacheSize:     100000,
 	}
 
 	// Read from file
@@ -65,6 +116,19 @@ func GetConfig() (Config, error) {
 	flag.StringVar(&config.Certificate, "certificate", config.Certificate, "Path to a file with a certificate")
 	flag.StringVar(&config.CryptoKey, "crypto-key", config.CryptoKey, "Path to a file with a private key")
 	flag.StringVar(&config.TrustedSubnet, "t", config.TrustedSubnet, "Trusted subnet")
+	flag.DurationVar(&config.ReplayWindow, "replay-window", config.ReplayWindow, "Allowed clock skew of the stamped metrics, replay protection is disabled if zero")
+	flag.IntVar(&config.ReplayCacheSize, "replay-cache-size", config.ReplayCacheSize, "Maximum number of remembered nonces")
+	flag.Float64Var(&config.IngestRequestRate, "ingest-request-rate", config.IngestRequestRate, "Requests per second allowed to every client, unlimited if zero")
+	flag.IntVar(&config.IngestRequestBurst, "ingest-request-burst", config.IngestRequestBurst, "Burst of requests allowed to every client")
+	flag.Float64Var(&config.IngestMetricRate, "ingest-metric-rate", config.IngestMetricRate, "Metrics per second allowed to every client, unlimited if zero")
+	flag.IntVar(&config.IngestMetricBurst, "ingest-metric-burst", config.IngestMetricBurst, "Burst of metrics allowed to every client")
+	flag.IntVar(&config.MaxSeries, "max-series", config.MaxSeries, "Number of distinct series accepted, unlimited if zero")
+	flag.StringVar(&config.AdminToken, "admin-token", config.AdminToken, "Bootstrap admin token, enables the token authentication")
+	flag.StringVar(&config.EncryptionKey, "encryption-key", config.EncryptionKey, "Path to a file with a private key to decrypt metrics")
+	flag.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "Time to drain in-flight requests on shutdown")
+	flag.DurationVar(&config.StorageCloseTimeout, "storage-close-timeout", config.StorageCloseTimeout, "Time to flush the storage on shutdown")
+	flag.DurationVar(&config.ScrapeInterval, "scrape-interval", config.ScrapeInterval, "Interval to scrape agents in the pull mode")
+	flag.StringVar(&config.ScrapeToken, "scrape-token", config.ScrapeToken, "Bearer token sent to the scraped agents")
 	flag.Parse()
 
 	// Populate data from the env variables
@@ -72,5 +136,50 @@ func GetConfig() (Config, error) {
 		return Config{}, errors.Wrap(err, "failed to parse server configuration from the environment variables")
 	}
 
+	if err := config.validate(); err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
+
+// validate checks the configuration.
+func (c Config) validate() error {
+	if len(c.ScrapeTargets) != 0 && c.ScrapeInterval <= 0 {
+		return errors.Errorf("scrape interval should be positive, got %s", c.ScrapeInterval)
+	}
+	return nil
+}
+
+// Keyring returns the keys to verify the metrics, Key is the one with an empty ID.
+func (c Config) Keyring() (*metric.Keyring, error) {
+	keys := append([]metric.Key{{Secret: c.Key}}, c.Keys...)
+	return metric.NewKeyring(keys...)
+}
+
+// redacted replaces the secrets in the logged configuration.
+const redacted = "REDACTED"
+
+// String formats the configuration with the secrets redacted, so it can be logged.
+func (c Config) String() string {
+	c.Key = redact(c.Key)
+	c.AdminToken = redact(c.AdminToken)
+	c.ScrapeToken = redact(c.ScrapeToken)
+	keys := make([]metric.Key, len(c.Keys))
+	for i, key := range c.Keys {
+		key.Secret = redact(key.Secret)
+		keys[i] = key
+	}
+	c.Keys = keys
+
+	// The methods are dropped, so the fields are formatted as is
+	type config Config
+	return fmt.Sprintf("%+v", config(c))
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
@@ -0,0 +1,58 @@
+package servercfg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+func TestConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{
+			name: "scraping",
+			conf: Config{ScrapeTargets: []string{"http://agent:9100"}, ScrapeInterval: time.Second},
+		},
+		{
+			name: "no scraping without interval",
+			conf: Config{},
+		},
+		{
+			name:    "scraping without interval",
+			conf:    Config{ScrapeTargets: []string{"http://agent:9100"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_String(t *testing.T) {
+	conf := Config{
+		Address:     "localhost:8080",
+		Key:         "hash-secret",
+		AdminToken:  "admin-secret",
+		ScrapeToken: "scrape-secret",
+		Keys:        []metric.Key{{ID: "old", Secret: "old-secret"}},
+	}
+
+	s := conf.String()
+	assert.Contains(t, s, "localhost:8080")
+	assert.Contains(t, s, "old")
+	assert.NotContains(t, s, "secret")
+	assert.Equal(t, "old-secret", conf.Keys[0].Secret)
+}
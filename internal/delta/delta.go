@@ -0,0 +1,90 @@
+package delta
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/ports"
+)
+
+// Tracker keeps the counter values acknowledged by the server, so only
+// the increments since the last successful send are reported.
+type Tracker struct {
+	key metric.Key
+
+	mx    sync.Mutex
+	acked map[string]int64
+}
+
+// NewTracker instantiates a new Tracker, the metrics are signed with the key.
+func NewTracker(key metric.Key) *Tracker {
+	return &Tracker{
+		key:   key,
+		acked: make(map[string]int64),
+	}
+}
+
+// Send converts cumulative counters into deltas and sends them.
+// The deltas are acknowledged only if send succeeds, otherwise they are
+// included into the next send. If send fails with ports.SeriesLimitError,
+// the rest of the batch was stored, so only the rejected counters are left
+// unacknowledged and the error is returned.
+func (t *Tracker) Send(metrics []*metric.Metric, send func([]*metric.Metric) error) error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	batch := make([]*metric.Metric, 0, len(metrics))
+	totals := make(map[string]int64)
+	for _, m := range metrics {
+		if m.Type() != metric.Counter {
+			// The hash is recalculated as the key may differ from the one of the storage
+			g := *m
+			t.sign(&g)
+			batch = append(batch, &g)
+			continue
+		}
+
+		acked, ok := t.acked[m.Name()]
+		d := *m.Delta - acked
+		if ok && d == 0 {
+			continue
+		}
+		// The source was restarted and counts from zero again, e.g. a scraped agent
+		if d < 0 {
+			d = *m.Delta
+		}
+
+		c := metric.NewCounter(m.Name(), d)
+		t.sign(c)
+		batch = append(batch, c)
+		totals[m.Name()] = *m.Delta
+	}
+
+	err := send(batch)
+	var limitErr *ports.SeriesLimitError
+	if err != nil && !errors.As(err, &limitErr) {
+		return err
+	}
+
+	for name, total := range totals {
+		if limitErr != nil && limitErr.Rejects(metric.Counter, name) {
+			continue
+		}
+		t.acked[name] = total
+	}
+
+	return err
+}
+
+func (t *Tracker) sign(m *metric.Metric) {
+	m.Hash = ""
+	m.KeyID = ""
+	if t.key.Secret == "" {
+		return
+	}
+
+	m.FillHash(t.key.Secret)
+	m.KeyID = t.key.ID
+}
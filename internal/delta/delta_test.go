@@ -0,0 +1,120 @@
+package delta
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/ports"
+)
+
+func TestTracker_Send(t *testing.T) {
+	type send struct {
+		total   int64
+		fail    bool
+		wantOut []*metric.Metric
+	}
+	tests := []struct {
+		name  string
+		sends []send
+	}{
+		{
+			name: "only deltas are sent",
+			sends: []send{
+				{total: 3, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 3)}},
+				{total: 5, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 2)}},
+				{total: 9, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 4)}},
+			},
+		},
+		{
+			name: "delta is kept after failure",
+			sends: []send{
+				{total: 3, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 3)}},
+				{total: 5, fail: true, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 2)}},
+				{total: 7, fail: true, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 4)}},
+				{total: 8, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 5)}},
+				{total: 9, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 1)}},
+			},
+		},
+		{
+			name: "unchanged counters are skipped",
+			sends: []send{
+				{total: 3, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 3)}},
+				{total: 3, wantOut: []*metric.Metric{}},
+			},
+		},
+		{
+			name: "reset of the source counter",
+			sends: []send{
+				{total: 10, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 10)}},
+				{total: 4, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 4)}},
+				{total: 6, wantOut: []*metric.Metric{metric.NewCounter("PollCount", 2)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(metric.Key{})
+			for _, s := range tt.sends {
+				var got []*metric.Metric
+				err := tracker.Send([]*metric.Metric{metric.NewCounter("PollCount", s.total)}, func(ms []*metric.Metric) error {
+					got = ms
+					if s.fail {
+						return errors.New("server is down")
+					}
+					return nil
+				})
+				assert.Equal(t, s.fail, err != nil)
+				require.Equal(t, s.wantOut, got)
+			}
+		})
+	}
+}
+
+func TestTracker_SendGauges(t *testing.T) {
+	tracker := NewTracker(metric.Key{})
+	g := metric.NewGauge("Alloc", 3.14)
+
+	for i := 0; i < 2; i++ {
+		err := tracker.Send([]*metric.Metric{g}, func(ms []*metric.Metric) error {
+			assert.Equal(t, []*metric.Metric{g}, ms)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestTracker_SendSeriesLimit(t *testing.T) {
+	tracker := NewTracker(metric.Key{})
+	counters := func(poll, requests int64) []*metric.Metric {
+		return []*metric.Metric{
+			metric.NewCounter("PollCount", poll),
+			metric.NewCounter("Requests", requests),
+			metric.NewGauge("PollCount", 1),
+		}
+	}
+
+	// The gauge of the same name is rejected, the counter is still acknowledged
+	err := tracker.Send(counters(3, 5), func(ms []*metric.Metric) error {
+		return &ports.SeriesLimitError{Rejected: []ports.Series{
+			{Type: metric.Counter, ID: "Requests"},
+			{Type: metric.Gauge, ID: "PollCount"},
+		}}
+	})
+	require.ErrorIs(t, err, ports.ErrSeriesLimit)
+
+	var got []*metric.Metric
+	err = tracker.Send(counters(4, 6), func(ms []*metric.Metric) error {
+		got = ms
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*metric.Metric{
+		metric.NewCounter("PollCount", 1),
+		metric.NewCounter("Requests", 6),
+		metric.NewGauge("PollCount", 1),
+	}, got)
+}
@@ -0,0 +1,198 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ContentEncoding is the value of the Content-Encoding header of encrypted bodies.
+const ContentEncoding = "rsa-oaep-aes-gcm"
+
+const (
+	aesKeySize    = 32
+	keyLengthSize = 2
+)
+
+// Encrypt encrypts the data with a random AES-GCM key which is itself encrypted
+// with RSA-OAEP. The result is laid out as
+// [length of the encrypted key: 2 bytes][encrypted key][nonce][ciphertext].
+func Encrypt(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+	key := make([]byte, aesKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "failed to generate a key")
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt the key")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate a nonce")
+	}
+
+	res := make([]byte, keyLengthSize, keyLengthSize+len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	binary.BigEndian.PutUint16(res, uint16(len(encryptedKey)))
+	res = append(res, encryptedKey...)
+	res = append(res, nonce...)
+
+	return gcm.Seal(res, nonce, data, nil), nil
+}
+
+// Decrypt decrypts the data encrypted by Encrypt.
+func Decrypt(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if len(data) < keyLengthSize {
+		return nil, errors.New("encrypted data is too short")
+	}
+	keyLength := int(binary.BigEndian.Uint16(data))
+	data = data[keyLengthSize:]
+	if len(data) < keyLength {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, data[:keyLength], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt the key")
+	}
+	data = data[keyLength:]
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	res, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt the data")
+	}
+
+	return res, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a GCM cipher")
+	}
+
+	return gcm, nil
+}
+
+// LoadPublicKey reads an RSA public key from a PEM file.
+// Both a public key and a certificate are accepted.
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse certificate")
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse public key")
+	}
+
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("key in %s is not an RSA key", path)
+	}
+
+	return pub, nil
+}
+
+// LoadPrivateKey reads an RSA private key in PKCS#1 or PKCS#8 from a PEM file.
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		return priv, errors.Wrap(err, "failed to parse private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse private key")
+	}
+
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("key in %s is not an RSA key", path)
+	}
+
+	return priv, nil
+}
+
+// GenerateKeyPair generates a new RSA key pair and encodes it in PEM.
+func GenerateKeyPair(bits int) (privatePEM []byte, publicPEM []byte, err error) {
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate a key")
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to marshal public key")
+	}
+
+	privatePEM = pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(priv),
+	})
+	publicPEM = pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pub,
+	})
+
+	return privatePEM, publicPEM, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read key file %s", path)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.Errorf("no PEM data found in %s", path)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,65 @@
+package encryption
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateKeys(t *testing.T) (privatePath string, publicPath string) {
+	privatePEM, publicPEM, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privatePath = filepath.Join(dir, "private.pem")
+	publicPath = filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(privatePath, privatePEM, 0600))
+	require.NoError(t, os.WriteFile(publicPath, publicPEM, 0600))
+
+	return privatePath, publicPath
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	privatePath, publicPath := generateKeys(t)
+	priv, err := LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+	pub, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+
+	data := []byte(`[{"id":"PollCount","type":"counter","delta":5}]`)
+
+	encrypted, err := Encrypt(pub, data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "PollCount")
+
+	decrypted, err := Decrypt(priv, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "tampered ciphertext",
+			data: append(append([]byte{}, encrypted[:len(encrypted)-1]...), encrypted[len(encrypted)-1]^1),
+		},
+		{
+			name: "truncated",
+			data: encrypted[:10],
+		},
+		{
+			name: "empty",
+			data: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(priv, tt.data)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -2,35 +2,90 @@ package grpcclient
 
 import (
 	"context"
+	"net"
+	"strings"
+	"sync/atomic"
 
 	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/netutil"
 	"github.com/denistakeda/alerting/internal/ports"
+	"github.com/denistakeda/alerting/internal/retry"
 	"github.com/denistakeda/alerting/proto"
 	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 )
 
 type GRPCClient struct {
-	address string
-	client  proto.AlertingClient
-	conn    *grpc.ClientConn
+	address     string
+	client      proto.AlertingClient
+	conn        *grpc.ClientConn
+	retryPolicy retry.Policy
+	retryCodes  map[codes.Code]bool
+	realIP      *netutil.RealIP
+	token       string
+}
+
+// Params are the parameters of GRPCClient.
+type Params struct {
+	Address string
+	// Cert is a path to the CA certificate to verify the server, the connection
+	// is plaintext if empty.
+	Cert string
+	// RealIP is sent in the x-real-ip metadata. If empty, the address of the
+	// interface used to reach the server is sent.
+	RealIP string
+	// Token is sent as a bearer token in the authorization metadata.
+	Token string
+
+	RetryPolicy retry.Policy
+	// RetryCodes are the status codes of transient failures. The call is only
+	// retried if the request has not been sent or the server asked to retry it
+	// with the retry-after header, otherwise the counters could be counted twice.
+	RetryCodes []codes.Code
 }
 
 var _ ports.Client = (*GRPCClient)(nil)
 
-func NewGRPCClient(address string) (*GRPCClient, error) {
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewGRPCClient creates a client of the server.
+func NewGRPCClient(params Params) (*GRPCClient, error) {
+	creds := insecure.NewCredentials()
+	if params.Cert != "" {
+		var err error
+		creds, err = credentials.NewClientTLSFromFile(params.Cert, "")
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load certificate file")
+		}
+	}
+
+	conn, err := grpc.Dial(params.Address, grpc.WithTransportCredentials(creds), grpc.WithStatsHandler(sentHandler{}))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create a connection")
 	}
 
 	client := proto.NewAlertingClient(conn)
 
+	retryCodes := make(map[codes.Code]bool, len(params.RetryCodes))
+	for _, code := range params.RetryCodes {
+		retryCodes[code] = true
+	}
+
 	return &GRPCClient{
-		address: address,
-		client:  client,
-		conn:    conn,
+		address:     params.Address,
+		client:      client,
+		conn:        conn,
+		retryPolicy: params.RetryPolicy,
+		retryCodes:  retryCodes,
+		realIP: netutil.NewRealIP(params.RealIP, func() (net.IP, error) {
+			return netutil.OutboundIP(params.Address)
+		}),
+		token: params.Token,
 	}, nil
 }
 
@@ -43,12 +98,93 @@ func (c *GRPCClient) SendMetrics(metrics []*metric.Metric) error {
 	var req proto.UpdateMetricsRequest
 	req.Metrics = ms
 
-	_, err := c.client.UpdateMetrics(context.Background(), &req)
-	if err != nil {
-		return errors.Wrap(err, "failed to send metrics to the server")
+	ctx := context.Background()
+	// The metadata is omitted while the server is unreachable to detect the address
+	if realIP := c.realIP.Get(); realIP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-real-ip", realIP)
+	}
+	if c.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+	}
+
+	return c.retryPolicy.Do(ctx, func() error {
+		var sent atomic.Bool
+		var header metadata.MD
+		_, err := c.client.UpdateMetrics(withSent(ctx, &sent), &req, grpc.Header(&header))
+		if err == nil {
+			return nil
+		}
+
+		if limitErr := seriesLimitError(err); limitErr != nil {
+			return limitErr
+		}
+
+		wrapped := errors.Wrap(err, "failed to send metrics to the server")
+		if c.retryCodes[status.Code(err)] && (!sent.Load() || len(header.Get("retry-after")) != 0) {
+			return retry.Retryable(wrapped)
+		}
+		return wrapped
+	})
+}
+
+// sentKey is the context key of the flag set once the request is sent.
+type sentKey struct{}
+
+func withSent(ctx context.Context, sent *atomic.Bool) context.Context {
+	return context.WithValue(ctx, sentKey{}, sent)
+}
+
+// sentHandler sets the flag of the call once its request is sent to the server.
+type sentHandler struct{}
+
+func (sentHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (sentHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	if _, ok := s.(*stats.OutPayload); !ok {
+		return
 	}
+	if sent, ok := ctx.Value(sentKey{}).(*atomic.Bool); ok {
+		sent.Store(true)
+	}
+}
 
-	return nil
+func (sentHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (sentHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// seriesLimitError parses the status of the server which rejected the new series,
+// nil is returned if the status has no series rejected.
+func seriesLimitError(err error) *ports.SeriesLimitError {
+	st := status.Convert(err)
+	if st.Code() != codes.FailedPrecondition {
+		return nil
+	}
+
+	var rejected []ports.Series
+	for _, detail := range st.Details() {
+		failure, ok := detail.(*errdetails.PreconditionFailure)
+		if !ok {
+			continue
+		}
+		for _, violation := range failure.GetViolations() {
+			if violation.GetType() != proto.SeriesLimitViolation {
+				continue
+			}
+			metricType, id, ok := strings.Cut(violation.GetSubject(), ":")
+			if !ok {
+				continue
+			}
+			rejected = append(rejected, ports.Series{Type: metric.Type(metricType), ID: id})
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	return &ports.SeriesLimitError{Rejected: rejected}
 }
 
 func (c *GRPCClient) Stop() error {
@@ -0,0 +1,156 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/middleware"
+	"github.com/denistakeda/alerting/internal/ports"
+	"github.com/denistakeda/alerting/internal/retry"
+	"github.com/denistakeda/alerting/proto"
+)
+
+type fakeServer struct {
+	proto.UnimplementedAlertingServer
+	update func(ctx context.Context) error
+}
+
+func (s *fakeServer) UpdateMetrics(ctx context.Context, _ *proto.UpdateMetricsRequest) (*empty.Empty, error) {
+	return &empty.Empty{}, s.update(ctx)
+}
+
+func startServer(t *testing.T, err error) string {
+	return startServerFunc(t, func(context.Context) error { return err })
+}
+
+func startServerFunc(t *testing.T, update func(ctx context.Context) error) string {
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, listenErr)
+
+	server := grpc.NewServer()
+	proto.RegisterAlertingServer(server, &fakeServer{update: update})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func TestGRPCClient_SendMetricsSeriesLimit(t *testing.T) {
+	rejected := status.New(codes.FailedPrecondition, "series limit exceeded")
+	rejected, err := rejected.WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{
+			{Type: proto.SeriesLimitViolation, Subject: "counter:Requests"},
+			{Type: "OTHER", Subject: "counter:PollCount"},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		err          error
+		wantRejected []ports.Series
+	}{
+		{
+			name:         "series rejected",
+			err:          rejected.Err(),
+			wantRejected: []ports.Series{{Type: metric.Counter, ID: "Requests"}},
+		},
+		{
+			name: "another failed precondition",
+			err:  status.Error(codes.FailedPrecondition, "failed precondition"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewGRPCClient(Params{
+				Address:     startServer(t, tt.err),
+				RealIP:      "127.0.0.1",
+				RetryPolicy: retry.Policy{MaxAttempts: 1},
+			})
+			require.NoError(t, err)
+			defer client.Stop()
+
+			err = client.SendMetrics([]*metric.Metric{metric.NewCounter("Requests", 1)})
+			require.Error(t, err)
+
+			var limitErr *ports.SeriesLimitError
+			if tt.wantRejected == nil {
+				assert.False(t, errors.As(err, &limitErr))
+				return
+			}
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, tt.wantRejected, limitErr.Rejected)
+		})
+	}
+}
+
+func TestGRPCClient_SendMetricsRetry(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	rateLimited := func(ctx context.Context) error {
+		return middleware.ResourceExhausted(ctx, time.Second)
+	}
+
+	tests := []struct {
+		name          string
+		address       func(t *testing.T) string
+		retryCodes    []codes.Code
+		wantRetryable bool
+	}{
+		{
+			name:          "server unreachable",
+			address:       func(*testing.T) string { return unreachable },
+			retryCodes:    []codes.Code{codes.Unavailable},
+			wantRetryable: true,
+		},
+		{
+			name: "unavailable after the request is received",
+			address: func(t *testing.T) string {
+				return startServer(t, status.Error(codes.Unavailable, "unavailable"))
+			},
+			retryCodes: []codes.Code{codes.Unavailable},
+		},
+		{
+			name:          "rate limited by the server",
+			address:       func(t *testing.T) string { return startServerFunc(t, rateLimited) },
+			retryCodes:    []codes.Code{codes.ResourceExhausted},
+			wantRetryable: true,
+		},
+		{
+			name:       "code is not retried",
+			address:    func(t *testing.T) string { return startServerFunc(t, rateLimited) },
+			retryCodes: []codes.Code{codes.Unavailable},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewGRPCClient(Params{
+				Address:     tt.address(t),
+				RealIP:      "127.0.0.1",
+				RetryPolicy: retry.Policy{MaxAttempts: 1},
+				RetryCodes:  tt.retryCodes,
+			})
+			require.NoError(t, err)
+			defer client.Stop()
+
+			err = client.SendMetrics([]*metric.Metric{metric.NewCounter("Requests", 1)})
+			require.Error(t, err)
+			assert.Equal(t, tt.wantRetryable, retry.IsRetryable(err))
+		})
+	}
+}
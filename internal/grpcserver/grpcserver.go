@@ -3,16 +3,26 @@ package grpcserver
 import (
 	"context"
 	"net"
+	"strings"
+	"sync/atomic"
 
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
 	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/middleware"
+	"github.com/denistakeda/alerting/internal/ratelimit"
+	"github.com/denistakeda/alerting/internal/replay"
 	"github.com/denistakeda/alerting/internal/services/loggerservice"
 	"github.com/denistakeda/alerting/internal/storage"
 	"github.com/denistakeda/alerting/proto"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
@@ -23,15 +33,55 @@ type GRPCServer struct {
 	address string
 	store   storage.Storage
 	logger  zerolog.Logger
+	access  *middleware.AccessPolicy
+	auth    *auth.Authenticator
+	keys    *metric.Keyring
+	replay  *replay.Guard
+	limiter *ratelimit.Limiter
+	audit   *audit.Log
+	ip      middleware.ClientIPResolver
+
+	server   *grpc.Server
+	health   *healthServer
+	inFlight atomic.Int64
+}
 
-	server *grpc.Server
+// Params are the parameters of GRPCServer. The access policy restricts the services
+// to the trusted networks, the authenticator requires the bearer tokens, the keys
+// verify the hashes of the metrics, the replay guard rejects the replayed ones and
+// the limiter limits the ingestion rate of the clients, everything is allowed if
+// they are nil. The audit log records the calls of the admin services.
+type Params struct {
+	Address string
+	Access  *middleware.AccessPolicy
+	Auth    *auth.Authenticator
+	Keys    *metric.Keyring
+	Replay  *replay.Guard
+	Limiter *ratelimit.Limiter
+	Audit   *audit.Log
+	// ClientIP tells apart the anonymous clients for the limiter and the audit log.
+	ClientIP middleware.ClientIPResolver
+
+	Storage    storage.Storage
+	LogService *loggerservice.LoggerService
 }
 
-func NewGRPCServer(log *loggerservice.LoggerService, store storage.Storage, address string) *GRPCServer {
+// NewGRPCServer creates a server on the given address.
+func NewGRPCServer(params Params) *GRPCServer {
+	logger := params.LogService.ComponentLogger("GRPCServer")
+
 	return &GRPCServer{
-		store:   store,
-		address: address,
-		logger:  log.ComponentLogger("GRPCServer"),
+		store:   params.Storage,
+		address: params.Address,
+		logger:  logger,
+		access:  params.Access,
+		auth:    params.Auth,
+		keys:    params.Keys,
+		replay:  params.Replay,
+		limiter: params.Limiter,
+		audit:   params.Audit,
+		ip:      params.ClientIP,
+		health:  newHealthServer(params.Storage, logger),
 	}
 }
 
@@ -44,8 +94,23 @@ func (s *GRPCServer) Start() <-chan error {
 		return res
 	}
 
-	s.server = grpc.NewServer()
+	s.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			s.trackInFlight,
+			s.access.UnaryServerInterceptor(routeGroup),
+			middleware.AuthUnaryServerInterceptor(s.auth, routeGroup),
+			middleware.RateLimitUnaryServerInterceptor(s.limiter, s.ip, routeGroup),
+			middleware.AuditUnaryServerInterceptor(s.audit, s.ip, routeGroup),
+		),
+		grpc.ChainStreamInterceptor(
+			s.access.StreamServerInterceptor(routeGroup),
+			middleware.AuthStreamServerInterceptor(s.auth, routeGroup),
+			middleware.AuditStreamServerInterceptor(s.audit, s.ip, routeGroup),
+		),
+	)
 	proto.RegisterAlertingServer(s.server, s)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	reflection.Register(s.server)
 
 	s.logger.Info().Msgf("GRPC server is listening on address %s", s.address)
 	go func() {
@@ -57,22 +122,120 @@ func (s *GRPCServer) Start() <-chan error {
 	return res
 }
 
-func (s *GRPCServer) Stop() {
-	s.server.Stop()
-	s.logger.Info().Msgf("GRPC server was stopped")
+// SetNotServing reports all the services as NOT_SERVING to health checkers.
+func (s *GRPCServer) SetNotServing() {
+	s.health.Shutdown()
+	s.logger.Info().Msg("GRPC server is marked as not serving")
+}
+
+// Stop stops the server gracefully, waiting for in-flight calls to finish.
+// If the context is done before that, the server is stopped forcibly.
+func (s *GRPCServer) Stop(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		s.logger.Info().Msg("GRPC server was stopped")
+		return nil
+	case <-ctx.Done():
+		inFlight := s.inFlight.Load()
+		s.server.Stop()
+		return errors.Errorf("GRPC server was stopped forcibly, %d in-flight calls were dropped", inFlight)
+	}
+}
+
+// routeGroup maps the method to the group of the access policy.
+func routeGroup(fullMethod string) middleware.RouteGroup {
+	service := strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2)[0]
+	switch service {
+	case proto.Alerting_ServiceDesc.ServiceName:
+		return middleware.GroupIngest
+	case healthpb.Health_ServiceDesc.ServiceName:
+		return middleware.GroupHealth
+	default:
+		// Reflection and any other service
+		return middleware.GroupAdmin
+	}
+}
+
+func (s *GRPCServer) trackInFlight(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	return handler(ctx, req)
 }
 
 func (s *GRPCServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetricsRequest) (*empty.Empty, error) {
 	s.logger.Debug().Msgf("got %d metrics", len(req.Metrics))
 
+	if wait, ok := s.limiter.AllowMetrics(ctx, len(req.Metrics)); !ok {
+		return nil, middleware.ResourceExhausted(ctx, wait)
+	}
+
 	ms := make([]*metric.Metric, 0, len(req.Metrics))
-	for _, m := range req.Metrics {
-		ms = append(ms, metric.FromProto(m))
+	for _, p := range req.Metrics {
+		m := metric.FromProto(p)
+		if err := m.Validate(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "incorrect metric %s: %v", m.ID, err)
+		}
+		if err := m.VerifyHashWithKeyring(s.keys); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "incorrect metric hash %s: %v", m.ID, err)
+		}
+		ms = append(ms, m)
+	}
+
+	// The nonces are remembered only once the whole batch is valid, so it is accepted if resent
+	accepted, err := s.replay.Accept(ms...)
+	if errors.Is(err, replay.ErrFull) {
+		// The metrics were not stored, so the client may resend them
+		return nil, middleware.ResourceExhausted(ctx, replay.RetryAfter)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "rejected metrics: %v", err)
 	}
 
 	if err := s.store.UpdateAll(ctx, ms); err != nil {
+		// The new series beyond the limits are rejected, the other metrics are stored
+		var limitErr *storage.SeriesLimitError
+		if errors.As(err, &limitErr) {
+			return nil, seriesLimitStatus(limitErr).Err()
+		}
+		accepted.Forget()
 		return nil, status.Errorf(codes.Internal, "failed to store metrics")
 	}
 
 	return &emptypb.Empty{}, nil
 }
+
+// seriesLimitStatus lists the rejected series in the details, so the client knows
+// which metrics were not stored.
+func seriesLimitStatus(limitErr *storage.SeriesLimitError) *status.Status {
+	failure := &errdetails.PreconditionFailure{
+		Violations: make([]*errdetails.PreconditionFailure_Violation, 0, len(limitErr.Rejected)),
+	}
+	for _, series := range limitErr.Rejected {
+		failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+			Type:    proto.SeriesLimitViolation,
+			Subject: series.String(),
+		})
+	}
+
+	st := status.New(codes.FailedPrecondition, limitErr.Error())
+	if detailed, err := st.WithDetails(failure); err == nil {
+		return detailed
+	}
+	return st
+}
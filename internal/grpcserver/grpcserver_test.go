@@ -0,0 +1,82 @@
+package grpcserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
+	"github.com/denistakeda/alerting/internal/middleware"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage/memstorage"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestGRPCServer_AuditStream(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	ctx := context.Background()
+	logService := loggerservice.New()
+	store := memstorage.NewMemStorage("", logService)
+	auditLog := audit.NewLog(store, logService)
+
+	address := freeAddress(t)
+	server := NewGRPCServer(Params{
+		Address:  address,
+		Auth:     auth.NewAuthenticator(store, adminToken),
+		Audit:    auditLog,
+		ClientIP: middleware.ClientIPResolver{PeerFallback: true, ProxiedRealIP: true},
+		Storage:  store,
+
+		LogService: logService,
+	})
+	server.Start()
+	defer server.Stop(ctx)
+
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The reflection is the admin service, it is a bidirectional stream
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	callCtx = metadata.AppendToOutgoingContext(callCtx,
+		"authorization", "Bearer "+adminToken,
+		"x-real-ip", "192.168.1.2",
+	)
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(callCtx, grpc.WaitForReady(true))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	}))
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+
+	entries, err := auditLog.Entries(ctx, audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", entries[0].Action)
+	assert.Equal(t, "bootstrap", entries[0].Actor)
+	assert.Equal(t, audit.OutcomeSuccess, entries[0].Outcome)
+	// The address reported by a client which is not a trusted proxy is ignored
+	assert.Equal(t, "127.0.0.1", entries[0].IP)
+}
@@ -0,0 +1,87 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/denistakeda/alerting/internal/storage"
+	"github.com/denistakeda/alerting/proto"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthPingInterval is the interval to ping the storage while the status is watched.
+const healthPingInterval = 5 * time.Second
+
+// healthServer implements grpc.health.v1 on top of the standard health server,
+// additionally reporting NOT_SERVING when the storage does not respond to ping.
+type healthServer struct {
+	*health.Server
+
+	store    storage.Storage
+	interval time.Duration
+	logger   zerolog.Logger
+}
+
+// healthServices are the services which status depends on the storage,
+// the empty name is the status of the whole server.
+var healthServices = []string{"", proto.Alerting_ServiceDesc.ServiceName}
+
+func newHealthServer(store storage.Storage, logger zerolog.Logger) *healthServer {
+	srv := health.NewServer()
+	srv.SetServingStatus(proto.Alerting_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	return &healthServer{
+		Server:   srv,
+		store:    store,
+		interval: healthPingInterval,
+		logger:   logger,
+	}
+}
+
+// Check returns the serving status of the requested service.
+func (h *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	h.ping(ctx)
+	return h.Server.Check(ctx, req)
+}
+
+// Watch streams the serving status of the requested service, the storage
+// is pinged periodically while the stream is open.
+func (h *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			h.ping(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return h.Server.Watch(req, stream)
+}
+
+// ping updates the status of the services by the storage ping, the status
+// is not changed anymore once the server is shut down.
+func (h *healthServer) ping(ctx context.Context) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if err := h.store.Ping(ctx); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Warn().Err(err).Msg("health check: storage is not available")
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	for _, service := range healthServices {
+		h.Server.SetServingStatus(service, status)
+	}
+}
@@ -0,0 +1,111 @@
+package grpcserver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage"
+	"github.com/denistakeda/alerting/internal/storage/memstorage"
+	"github.com/denistakeda/alerting/proto"
+)
+
+// pingStorage is a storage which ping fails while the error is set.
+type pingStorage struct {
+	storage.Storage
+
+	mx  sync.Mutex
+	err error
+}
+
+func (s *pingStorage) Ping(context.Context) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.err
+}
+
+func (s *pingStorage) setErr(err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.err = err
+}
+
+func TestGRPCServer_Health(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logService := loggerservice.New()
+	store := &pingStorage{Storage: memstorage.NewMemStorage("", logService)}
+
+	address := freeAddress(t)
+	server := NewGRPCServer(Params{
+		Address:    address,
+		Storage:    store,
+		LogService: logService,
+	})
+	server.health.interval = 10 * time.Millisecond
+	server.Start()
+	defer server.Stop(context.Background())
+
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	service := &healthpb.HealthCheckRequest{Service: proto.Alerting_ServiceDesc.ServiceName}
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(ctx, service, grpc.WaitForReady(true))
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check())
+	store.setErr(errors.New("database is down"))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check())
+
+	// The watchers are told about the storage without calling Check
+	watch, err := client.Watch(ctx, service)
+	require.NoError(t, err)
+	waitFor := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		for {
+			resp, err := watch.Recv()
+			require.NoError(t, err)
+			if resp.Status == want {
+				return
+			}
+		}
+	}
+	waitFor(healthpb.HealthCheckResponse_NOT_SERVING)
+	store.setErr(nil)
+	waitFor(healthpb.HealthCheckResponse_SERVING)
+
+	// The server stays not serving once shutting down, even if the storage is fine
+	server.SetNotServing()
+	waitFor(healthpb.HealthCheckResponse_NOT_SERVING)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check())
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	var services []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		services = append(services, s.GetName())
+	}
+	assert.Contains(t, services, proto.Alerting_ServiceDesc.ServiceName)
+	assert.Contains(t, services, healthpb.Health_ServiceDesc.ServiceName)
+	require.NoError(t, stream.CloseSend())
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/denistakeda/alerting/internal/audit"
+)
+
+type auditQuery struct {
+	Actor  string    `form:"actor"`
+	Action string    `form:"action"`
+	Since  time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int       `form:"limit" binding:"gte=0"`
+}
+
+// AuditHandler godoc
+// @Summary returns the newest entries of the audit log
+// @Param actor query string false "Token ID"
+// @Param action query string false "Operation, e.g. token.create"
+// @Param since query string false "RFC 3339 time, inclusive"
+// @Param until query string false "RFC 3339 time, exclusive"
+// @Param limit query int false "Number of entries, 100 by default and 1000 at most"
+// @Produce json
+// @Success 200
+// @Failure 400
+// @Router /api/v1/audit [get]
+func (h *Handler) AuditHandler(c *gin.Context) {
+	var query auditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to bind audit query")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.audit.Entries(c, audit.Filter{
+		Actor:  query.Actor,
+		Action: query.Action,
+		Since:  query.Since,
+		Until:  query.Until,
+		Limit:  query.Limit,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to query audit log")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// record writes the operation of the request to the audit log.
+func (h *Handler) record(c *gin.Context, action, target string, outcome audit.Outcome, details string) {
+	h.audit.Record(c.Request.Context(), h.clientIP.ClientIP(c.Request), action, target, outcome, details)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	s "github.com/denistakeda/alerting/internal/storage"
+)
+
+// CardinalityHandler godoc
+// @Summary returns the number of distinct series and their limits
+// @Produce json
+// @Success 200
+// @Router /admin/cardinality [get]
+func (h *Handler) CardinalityHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.series.Cardinality())
+}
+
+// seriesLimitExceeded aborts the request if new series were rejected by the
+// cardinality limits. The other metrics of the request are stored by then.
+func (h *Handler) seriesLimitExceeded(c *gin.Context, err error) bool {
+	var limitErr *s.SeriesLimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+
+	h.logger.Warn().Err(err).Msg("new series were rejected")
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+		"error":    s.ErrSeriesLimit.Error(),
+		"rejected": limitErr.Rejected,
+	})
+	return true
+}
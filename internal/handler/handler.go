@@ -2,34 +2,74 @@ package handler
 
 import (
 	"context"
+	"crypto/rsa"
 	"net/http"
-	"time"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/middleware"
+	"github.com/denistakeda/alerting/internal/ratelimit"
+	"github.com/denistakeda/alerting/internal/replay"
 	"github.com/denistakeda/alerting/internal/services/loggerservice"
 	s "github.com/denistakeda/alerting/internal/storage"
+	"github.com/denistakeda/alerting/internal/storage/limitstorage"
 )
 
 type Handler struct {
-	hashKey    string
+	keys       *metric.Keyring
+	replay     *replay.Guard
+	limiter    *ratelimit.Limiter
+	clientIP   middleware.ClientIPResolver
 	logger     zerolog.Logger
 	cert       string
 	privateKey string
+	decryption *rsa.PrivateKey
+	access     *middleware.AccessPolicy
+	auth       *auth.Authenticator
+	tokens     s.TokenStorage
+	series     *limitstorage.Limitstorage
+	audit      *audit.Log
 
 	engine  *gin.Engine
 	storage s.Storage
 
-	server *http.Server
+	server   *http.Server
+	inFlight atomic.Int64
 }
 
 type Params struct {
-	Addr       string
-	HashKey    string
+	Addr string
+	// Keys verify the hashes of the metrics, nothing is verified if nil.
+	Keys       *metric.Keyring
 	Cert       string
 	PrivateKey string
+	// Decryption decrypts the request bodies and requires the ingested ones to be encrypted,
+	// nothing is decrypted if nil.
+	Decryption *rsa.PrivateKey
+	// Replay rejects the replayed metrics, nothing is checked if nil.
+	Replay *replay.Guard
+	// Limiter limits the ingestion rate of the clients, told apart by the token
+	// or by the address determined with ClientIP. Nothing is limited if nil.
+	Limiter  *ratelimit.Limiter
+	ClientIP middleware.ClientIPResolver
+	// Access restricts the route groups to the trusted networks, everything is allowed if nil.
+	Access *middleware.AccessPolicy
+	// Auth requires the bearer tokens, everything is allowed if nil.
+	Auth *auth.Authenticator
+	// Tokens are managed by the admin routes, which are not registered if nil
+	// or if Auth is nil, as anyone could create the tokens then.
+	Tokens s.TokenStorage
+	// Series reports the cardinality of the storage, the admin route is not registered if nil.
+	Series *limitstorage.Limitstorage
+	// Audit records the administrative operations and is queried by the admin route,
+	// which is not registered if nil.
+	Audit *audit.Log
 
 	Engine     *gin.Engine
 	Storage    s.Storage
@@ -41,9 +81,18 @@ func New(params Params) *Handler {
 	handler := &Handler{
 		engine:     params.Engine,
 		storage:    params.Storage,
-		hashKey:    params.HashKey,
+		keys:       params.Keys,
+		replay:     params.Replay,
+		limiter:    params.Limiter,
+		clientIP:   params.ClientIP,
 		cert:       params.Cert,
 		privateKey: params.PrivateKey,
+		decryption: params.Decryption,
+		access:     params.Access,
+		auth:       params.Auth,
+		tokens:     params.Tokens,
+		series:     params.Series,
+		audit:      params.Audit,
 		logger:     params.LogService.ComponentLogger("Handler"),
 
 		server: &http.Server{
@@ -76,25 +125,69 @@ func (h *Handler) Start() <-chan error {
 	return out
 }
 
-func (h *Handler) Stop() {
-	// The context is used to inform the server it has 5 seconds to finish
-	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
+// Stop stops the server gracefully, waiting for in-flight requests to finish.
+// If the context is done before that, the server is closed forcibly.
+func (h *Handler) Stop(ctx context.Context) error {
 	if err := h.server.Shutdown(ctx); err != nil {
-		h.logger.Fatal().Err(err).Msg("failed to stop server")
+		inFlight := h.inFlight.Load()
+		if err := h.server.Close(); err != nil {
+			h.logger.Error().Err(err).Msg("failed to close server")
+		}
+		return errors.Wrapf(err, "server was stopped forcibly, %d in-flight requests were dropped", inFlight)
 	}
 
 	h.logger.Info().Msg("server exiting")
+	return nil
+}
+
+func (h *Handler) trackInFlight(c *gin.Context) {
+	h.inFlight.Add(1)
+	defer h.inFlight.Add(-1)
+
+	c.Next()
 }
 
 func (h *Handler) registerHandlers(engine *gin.Engine) {
-	engine.POST("/update/", h.UpdateMetricHandler2)
-	engine.POST("/update/:metric_type/:metric_name/:metric_value", h.UpdateMetricHandler)
-	engine.POST("/updates/", h.UpdateMetricsHandler)
-	engine.POST("/value/", h.GetMetricHandler2)
-	engine.GET("/value/:metric_type/:metric_name", h.GetMetricHandler)
-	engine.GET("/ping", h.PingHandler)
-	engine.GET("/", h.MainPageHandler)
+	engine.Use(h.trackInFlight)
+
+	ingest := h.group(engine, middleware.GroupIngest)
+	ingest.POST("/update/", h.UpdateMetricHandler2)
+	ingest.POST("/update/:metric_type/:metric_name/:metric_value", h.UpdateMetricHandler)
+	ingest.POST("/updates/", middleware.VerifyBodySignature(h.keys), h.UpdateMetricsHandler)
+
+	read := h.group(engine, middleware.GroupRead)
+	read.POST("/value/", h.GetMetricHandler2)
+	read.GET("/value/:metric_type/:metric_name", h.GetMetricHandler)
+	read.GET("/", h.MainPageHandler)
+
+	health := h.group(engine, middleware.GroupHealth)
+	health.GET("/ping", h.PingHandler)
+
+	admin := h.group(engine, middleware.GroupAdmin)
+	if h.tokens != nil && h.auth != nil {
+		admin.POST("/admin/tokens", h.CreateTokenHandler)
+		admin.GET("/admin/tokens", h.ListTokensHandler)
+		admin.DELETE("/admin/tokens/:id", h.RevokeTokenHandler)
+	}
+	if h.limiter != nil {
+		admin.GET("/admin/ratelimit", h.RateLimitStatsHandler)
+	}
+	if h.series != nil {
+		admin.GET("/admin/cardinality", h.CardinalityHandler)
+	}
+	if h.audit != nil {
+		admin.GET("/api/v1/audit", h.AuditHandler)
+	}
+}
+
+// group returns the routes restricted by the access policy, the token scope
+// and the rate limits of the group, with the request bodies decrypted.
+func (h *Handler) group(engine *gin.Engine, group middleware.RouteGroup) *gin.RouterGroup {
+	return engine.Group(
+		"/",
+		h.access.Middleware(group),
+		middleware.Authenticate(h.auth, group),
+		middleware.RateLimit(h.limiter, h.clientIP, group),
+		middleware.DecryptMiddleware(h.decryption, group),
+	)
 }
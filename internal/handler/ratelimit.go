@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/denistakeda/alerting/internal/ratelimit"
+)
+
+// RateLimitStatsHandler godoc
+// @Summary returns the counters of the rate-limited requests
+// @Produce json
+// @Success 200
+// @Router /admin/ratelimit [get]
+func (h *Handler) RateLimitStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.limiter.Stats())
+}
+
+// allowMetrics takes n metrics from the rate limit of the client, the request
+// is aborted if they are not allowed.
+func (h *Handler) allowMetrics(c *gin.Context, n int) bool {
+	wait, ok := h.limiter.AllowMetrics(c.Request.Context(), n)
+	if !ok {
+		h.logger.Warn().Msgf("rate limit of metrics exceeded, %d metrics were rejected", n)
+		c.Header("Retry-After", ratelimit.RetryAfter(wait))
+		c.AbortWithStatus(http.StatusTooManyRequests)
+	}
+	return ok
+}
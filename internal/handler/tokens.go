@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
+)
+
+// The actions of the token management in the audit log.
+const (
+	auditTokenCreate = "token.create"
+	auditTokenRevoke = "token.revoke"
+)
+
+type createTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+type tokenResponse struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Scopes    auth.Scopes `json:"scopes"`
+	CreatedAt time.Time   `json:"created_at"`
+	// Token is only returned once, on creation.
+	Token string `json:"token,omitempty"`
+}
+
+func newTokenResponse(token *auth.Token) tokenResponse {
+	return tokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+	}
+}
+
+// CreateTokenHandler godoc
+// @Summary creates an API token, the secret is returned only once
+// @Accept  json
+// @Produce json
+// @Success 201
+// @Failure 400
+// @Router /admin/tokens [post]
+func (h *Handler) CreateTokenHandler(c *gin.Context) {
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to bind token request")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("incorrect token scopes")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	token, secret, err := auth.NewToken(req.Name, scopes)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to generate a token")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	details := fmt.Sprintf("name=%s scopes=%v", token.Name, token.Scopes)
+	if err := h.tokens.SaveToken(c, token); err != nil {
+		h.logger.Error().Err(err).Msg("failed to save a token")
+		h.record(c, auditTokenCreate, token.ID, audit.OutcomeFailure, details)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	h.record(c, auditTokenCreate, token.ID, audit.OutcomeSuccess, details)
+
+	resp := newTokenResponse(token)
+	resp.Token = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListTokensHandler godoc
+// @Summary returns all the API tokens without secrets
+// @Produce json
+// @Success 200
+// @Router /admin/tokens [get]
+func (h *Handler) ListTokensHandler(c *gin.Context) {
+	tokens, err := h.tokens.Tokens(c)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list tokens")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]tokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		resp = append(resp, newTokenResponse(token))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeTokenHandler godoc
+// @Summary revokes an API token
+// @Param id path string true "Token ID"
+// @Success 204
+// @Failure 404
+// @Router /admin/tokens/{id} [delete]
+func (h *Handler) RevokeTokenHandler(c *gin.Context) {
+	id := c.Param("id")
+	err := h.tokens.RevokeToken(c, id)
+	if errors.Is(err, auth.ErrTokenNotFound) {
+		h.record(c, auditTokenRevoke, id, audit.OutcomeFailure, err.Error())
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to revoke a token")
+		h.record(c, auditTokenRevoke, id, audit.OutcomeFailure, err.Error())
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	h.record(c, auditTokenRevoke, id, audit.OutcomeSuccess, "")
+
+	c.Status(http.StatusNoContent)
+}
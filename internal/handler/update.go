@@ -10,6 +10,9 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/middleware"
+	"github.com/denistakeda/alerting/internal/ratelimit"
+	"github.com/denistakeda/alerting/internal/replay"
 )
 
 var (
@@ -42,10 +45,23 @@ func (h *Handler) UpdateMetricHandler(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	if !h.allowMetrics(c, 1) {
+		return
+	}
+	// The URI can't carry the stamp, so the route is rejected along with the replay protection
+	if _, err := h.replay.Accept(m); err != nil {
+		h.logger.Warn().Err(err).Msgf("rejected metric %s", m.ID)
+		replayRejected(c, err)
+		return
+	}
 
 	if _, err := h.storage.Update(c, m); err != nil {
+		if h.seriesLimitExceeded(c, err) {
+			return
+		}
 		h.logger.Warn().Err(err).Msgf("failed to update a metric %v", m)
 		c.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
 	c.Status(http.StatusOK)
 }
@@ -62,15 +78,29 @@ func (h *Handler) UpdateMetricHandler2(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	if !h.allowMetrics(c, 1) {
+		return
+	}
 
-	if err := m.VerifyHash(h.hashKey); err != nil {
+	if err := m.VerifyHashWithKeyring(h.keys); err != nil {
 		h.logger.Warn().Err(err).Msgf("incorrect metric hash %v", m.Hash)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	accepted, err := h.replay.Accept(m)
+	if err != nil {
+		h.logger.Warn().Err(err).Msgf("rejected metric %s", m.ID)
+		replayRejected(c, err)
+		return
+	}
 
-	m, err := h.storage.Update(c, m)
+	m, err = h.storage.Update(c, m)
 	if err != nil {
+		if h.seriesLimitExceeded(c, err) {
+			return
+		}
+		// The metric was not stored, so it is accepted if resent
+		accepted.Forget()
 		h.logger.Warn().Err(err).Msgf("failed to update a metric %v", m)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -86,20 +116,41 @@ func (h *Handler) UpdateMetricsHandler(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	if !h.allowMetrics(c, len(metrics)) {
+		return
+	}
+
+	// The metrics are not verified one by one if the whole batch is covered by its signature
+	signed := middleware.BodySigned(c)
 	for _, m := range metrics {
 		if err := m.Validate(); err != nil {
 			h.logger.Warn().Err(err).Msgf("incorrect metric %v", m)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		if err := m.VerifyHash(h.hashKey); err != nil {
-			h.logger.Warn().Err(err).Msgf("incorrect metric hash %v", m.Hash)
-			c.AbortWithStatus(http.StatusBadRequest)
-			return
+		if !signed {
+			if err := m.VerifyHashWithKeyring(h.keys); err != nil {
+				h.logger.Warn().Err(err).Msgf("incorrect metric hash %v", m.Hash)
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
 		}
 	}
 
+	// The nonces are remembered only once the whole batch is valid, so it is accepted if resent
+	accepted, err := h.replay.Accept(metrics...)
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("rejected metrics")
+		replayRejected(c, err)
+		return
+	}
+
 	if err := h.storage.UpdateAll(c, metrics); err != nil {
+		// The rest of the batch was stored, so the nonces are kept
+		if h.seriesLimitExceeded(c, err) {
+			return
+		}
+		accepted.Forget()
 		h.logger.Warn().Err(err).Msg("failed to update a metrics")
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -109,6 +160,16 @@ func (h *Handler) UpdateMetricsHandler(c *gin.Context) {
 
 }
 
+// replayRejected responds to the metrics rejected by the replay protection.
+func replayRejected(c *gin.Context, err error) {
+	if errors.Is(err, replay.ErrFull) {
+		c.Header("Retry-After", ratelimit.RetryAfter(replay.RetryAfter))
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+	c.AbortWithStatus(http.StatusBadRequest)
+}
+
 func createMetric(uri updateMetricURI) (*metric.Metric, error) {
 	switch uri.MetricType {
 	case "gauge":
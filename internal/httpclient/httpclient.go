@@ -2,22 +2,60 @@ package httpclient
 
 import (
 	"bytes"
+	"context"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"sync/atomic"
 
+	"github.com/denistakeda/alerting/internal/encryption"
 	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/netutil"
 	"github.com/denistakeda/alerting/internal/ports"
+	"github.com/denistakeda/alerting/internal/retry"
 	"github.com/pkg/errors"
 )
 
 // HTTPClient is a rate-limited client
 type HTTPClient struct {
-	bus     chan *task
-	address string
+	bus           chan *task
+	address       string
+	encryptionKey *rsa.PublicKey
+	realIP        *netutil.RealIP
+	token         string
+	key           metric.Key
+
+	retryPolicy      retry.Policy
+	retryStatusCodes map[int]bool
+}
+
+// Params are the parameters of HTTPClient.
+type Params struct {
+	// RateLimit is the maximum amount of active requests.
+	RateLimit int
+	// Cert is a path to the CA certificate to verify the server.
+	Cert    string
+	Address string
+	// EncryptionKey is a path to the public key of the server to encrypt the payload.
+	EncryptionKey string
+	// RealIP is sent in the X-Real-IP header. If empty, the address of the
+	// interface used to reach the server is sent.
+	RealIP string
+	// Token is sent as a bearer token in the Authorization header.
+	Token string
+	// Key signs the whole body of the request, nothing is signed if empty.
+	Key metric.Key
+
+	RetryPolicy      retry.Policy
+	RetryStatusCodes []int
 }
 
 var _ ports.Client = (*HTTPClient)(nil)
@@ -29,11 +67,11 @@ type task struct {
 }
 
 // New instantiates a new HTTPClient
-func New(rateLimit int, cert string, address string) (*HTTPClient, error) {
+func New(params Params) (*HTTPClient, error) {
 	client := &http.Client{}
 
-	if cert != "" {
-		caCert, err := os.ReadFile(cert)
+	if params.Cert != "" {
+		caCert, err := os.ReadFile(params.Cert)
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to find certificate file")
 		}
@@ -48,14 +86,37 @@ func New(rateLimit int, cert string, address string) (*HTTPClient, error) {
 		}
 	}
 
+	var encryptionKey *rsa.PublicKey
+	if params.EncryptionKey != "" {
+		var err error
+		encryptionKey, err = encryption.LoadPublicKey(params.EncryptionKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load encryption key")
+		}
+	}
+
 	bus := make(chan *task)
-	for i := 0; i < rateLimit; i++ {
+	for i := 0; i < params.RateLimit; i++ {
 		go handleRequests(bus, client)
 	}
 
+	codes := make(map[int]bool, len(params.RetryStatusCodes))
+	for _, code := range params.RetryStatusCodes {
+		codes[code] = true
+	}
+
 	return &HTTPClient{
-		bus:     bus,
-		address: address,
+		bus:           bus,
+		address:       params.Address,
+		encryptionKey: encryptionKey,
+		realIP: netutil.NewRealIP(params.RealIP, func() (net.IP, error) {
+			return outboundIP(params.Address)
+		}),
+		token: params.Token,
+		key:   params.Key,
+
+		retryPolicy:      params.RetryPolicy,
+		retryStatusCodes: codes,
 	}, nil
 }
 
@@ -65,30 +126,128 @@ func (c *HTTPClient) SendMetrics(metrics []*metric.Metric) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal metrics")
 	}
-	body := bytes.NewBuffer(m)
 
-	req, err := http.NewRequest(http.MethodPost, url, body)
+	// The plain body is signed, as the server verifies it after decryption
+	headers := make(http.Header)
+	if c.key.Secret != "" {
+		headers.Set(metric.BatchHashHeader, metric.BatchHash(m, c.key.Secret))
+		if c.key.ID != "" {
+			headers.Set(metric.BatchKeyIDHeader, c.key.ID)
+		}
+	}
+
+	if c.encryptionKey != nil {
+		m, err = encryption.Encrypt(c.encryptionKey, m)
+		if err != nil {
+			return errors.Wrap(err, "failed to encrypt metrics")
+		}
+	}
+
+	return c.retryPolicy.Do(context.Background(), func() error {
+		return c.post(url, m, headers)
+	})
+}
+
+func (c *HTTPClient) post(url string, body []byte, headers http.Header) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
 	if err != nil {
 		return errors.Wrap(err, "failed to create a request")
 	}
 
+	for name := range headers {
+		req.Header.Set(name, headers.Get(name))
+	}
+
 	req.Header.Set("Content-Type", "application/json")
+	if c.encryptionKey != nil {
+		req.Header.Set("Content-Encoding", encryption.ContentEncoding)
+	}
+	// The header is omitted while the server is unreachable to detect the address
+	if realIP := c.realIP.Get(); realIP != "" {
+		req.Header.Set("X-Real-IP", realIP)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// Only the failures before the request is written are retried, otherwise the
+	// server may have stored the metrics already and the counters would be counted twice
+	var written atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				written.Store(true)
+			}
+		},
+	}))
 
 	resp, err := c.Do(req)
 	if err != nil {
-		return errors.Wrapf(err, "unable to file a request to URL: %s", url)
+		err = errors.Wrapf(err, "unable to file a request to URL: %s", url)
+		if !written.Load() {
+			return retry.Retryable(err)
+		}
+		return err
+	}
+	var limitErr *ports.SeriesLimitError
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		limitErr = seriesLimitError(resp.Body)
 	}
 	if err := resp.Body.Close(); err != nil {
 		return errors.Wrap(err, "unable to close a body")
 	}
 
+	if limitErr != nil {
+		return limitErr
+	}
 	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("not successfull status %d", resp.StatusCode)
+		err := errors.Errorf("not successfull status %d", resp.StatusCode)
+		if c.retryStatusCodes[resp.StatusCode] {
+			return retry.Retryable(err)
+		}
+		return err
 	}
 
 	return nil
 }
 
+// maxResponseBodySize limits the size of the responses read from the server.
+const maxResponseBodySize = 1 << 20
+
+// seriesLimitError parses the response of the server which rejected the new
+// series, nil is returned if the body is not such a response.
+func seriesLimitError(body io.Reader) *ports.SeriesLimitError {
+	var resp struct {
+		Error    string         `json:"error"`
+		Rejected []ports.Series `json:"rejected"`
+	}
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil
+	}
+	if resp.Error != ports.ErrSeriesLimit.Error() {
+		return nil
+	}
+	return &ports.SeriesLimitError{Rejected: resp.Rejected}
+}
+
+// outboundIP returns the address of the local interface used to reach the server.
+func outboundIP(address string) (net.IP, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid server address")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return netutil.OutboundIP(net.JoinHostPort(u.Hostname(), port))
+}
+
 func (*HTTPClient) Stop() error {
 	// Do nothing
 	return nil
@@ -121,10 +280,16 @@ func handleRequests(bus <-chan *task, client *http.Client) {
 			continue
 		}
 
-		if err := resp.Body.Close(); err != nil {
+		// The body is read here, so the request is over once the worker is free
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+		if closeErr := resp.Body.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
 			t.errChan <- err
 			continue
 		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
 
 		t.respChan <- resp
 	}
@@ -0,0 +1,226 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/ports"
+	"github.com/denistakeda/alerting/internal/retry"
+)
+
+func TestHTTPClient_SendMetricsRetries(t *testing.T) {
+	policy := retry.Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+		Jitter:      0.5,
+	}
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{
+			name:         "success from the first attempt",
+			statuses:     []int{http.StatusOK},
+			wantErr:      false,
+			wantAttempts: 1,
+		},
+		{
+			name:         "success after transient failures",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			wantErr:      false,
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts are exhausted",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "non-retryable status",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.statuses[attempt-1])
+			}))
+			defer server.Close()
+
+			client, err := New(Params{
+				RateLimit:        1,
+				Address:          server.URL,
+				RetryPolicy:      policy,
+				RetryStatusCodes: []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+			})
+			require.NoError(t, err)
+
+			err = client.SendMetrics([]*metric.Metric{metric.NewGauge("g", 1)})
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantAttempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestHTTPClient_SendMetricsRealIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		realIP string
+		want   string
+	}{
+		{
+			name:   "configured address",
+			realIP: "192.168.1.10",
+			want:   "192.168.1.10",
+		},
+		{
+			name:   "detected address",
+			realIP: "",
+			want:   "127.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers <- r.Header.Get("X-Real-IP")
+			}))
+			defer server.Close()
+
+			client, err := New(Params{
+				RateLimit:   1,
+				Address:     server.URL,
+				RealIP:      tt.realIP,
+				RetryPolicy: retry.Policy{MaxAttempts: 1},
+			})
+			require.NoError(t, err)
+
+			require.NoError(t, client.SendMetrics([]*metric.Metric{metric.NewGauge("g", 1)}))
+			assert.Equal(t, tt.want, <-headers)
+		})
+	}
+}
+
+func TestHTTPClient_SendMetricsBatchHash(t *testing.T) {
+	type request struct {
+		body    []byte
+		headers http.Header
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{body: body, headers: r.Header}
+	}))
+	defer server.Close()
+
+	key := metric.Key{ID: "2023-05", Secret: "secret"}
+	client, err := New(Params{
+		RateLimit:   1,
+		Address:     server.URL,
+		Key:         key,
+		RetryPolicy: retry.Policy{MaxAttempts: 1},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.SendMetrics([]*metric.Metric{metric.NewGauge("g", 1)}))
+	req := <-requests
+	assert.True(t, metric.VerifyBatchHash(req.body, key.Secret, req.headers.Get(metric.BatchHashHeader)))
+	assert.Equal(t, key.ID, req.headers.Get(metric.BatchKeyIDHeader))
+}
+
+func TestHTTPClient_SendMetricsNetworkErrors(t *testing.T) {
+	policy := retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	t.Run("connection failure before the request is sent", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		address := server.URL
+		server.Close()
+
+		client, err := New(Params{RateLimit: 1, Address: address, RealIP: "127.0.0.1", RetryPolicy: policy})
+		require.NoError(t, err)
+
+		err = client.SendMetrics([]*metric.Metric{metric.NewGauge("g", 1)})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "gave up after 3 attempts")
+	})
+
+	t.Run("connection lost after the request is sent", func(t *testing.T) {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+		}))
+		defer server.Close()
+
+		client, err := New(Params{RateLimit: 1, Address: server.URL, RetryPolicy: policy})
+		require.NoError(t, err)
+
+		err = client.SendMetrics([]*metric.Metric{metric.NewCounter("c", 1)})
+		require.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&attempts), "the server may have stored the metrics")
+	})
+}
+
+func TestHTTPClient_SendMetricsSeriesLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantRejected []ports.Series
+	}{
+		{
+			name:         "series rejected",
+			body:         `{"error":"series limit exceeded","rejected":[{"type":"counter","id":"Requests"}]}`,
+			wantRejected: []ports.Series{{Type: metric.Counter, ID: "Requests"}},
+		},
+		{
+			name: "another unprocessable request",
+			body: `{"error":"invalid metric"}`,
+		},
+		{
+			name: "no body",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client, err := New(Params{RateLimit: 1, Address: server.URL, RealIP: "127.0.0.1", RetryPolicy: retry.Policy{MaxAttempts: 1}})
+			require.NoError(t, err)
+
+			err = client.SendMetrics([]*metric.Metric{metric.NewCounter("Requests", 1)})
+			require.Error(t, err)
+
+			var limitErr *ports.SeriesLimitError
+			if tt.wantRejected == nil {
+				assert.False(t, errors.As(err, &limitErr))
+				return
+			}
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, tt.wantRejected, limitErr.Rejected)
+		})
+	}
+}
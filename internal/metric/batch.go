@@ -0,0 +1,31 @@
+package metric
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+)
+
+const (
+	// BatchHashHeader is the header with the hash of the whole serialized batch.
+	BatchHashHeader = "HashSHA256"
+	// BatchKeyIDHeader is the header with the ID of the key the batch hash is calculated with.
+	BatchKeyIDHeader = "HashKeyID"
+)
+
+// BatchHash returns the hash of the serialized batch of metrics.
+func BatchHash(body []byte, key string) string {
+	return hash(string(body), key)
+}
+
+// VerifyBatchHash verifies the hash of the serialized batch of metrics.
+func VerifyBatchHash(body []byte, key string, batchHash string) bool {
+	expected, err := hex.DecodeString(BatchHash(body, key))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(batchHash)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
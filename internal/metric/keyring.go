@@ -0,0 +1,80 @@
+package metric
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Key is a named key to sign the metrics.
+type Key struct {
+	// ID is sent along with the metrics, the key with an empty ID is used
+	// for the metrics without ID.
+	ID     string `json:"id"`
+	Secret string `json:"key"`
+	// Expires is the time the key stops being accepted, it never expires if zero.
+	Expires time.Time `json:"expires"`
+}
+
+// Keyring holds the keys accepted by the server. Several keys can be active at
+// the same time, so the agents can be switched to a new key one by one.
+type Keyring struct {
+	keys map[string]Key
+	now  func() time.Time
+}
+
+// NewKeyring instantiates a new Keyring, keys with an empty secret are ignored.
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	ring := &Keyring{
+		keys: make(map[string]Key, len(keys)),
+		now:  time.Now,
+	}
+
+	for _, key := range keys {
+		if key.Secret == "" {
+			continue
+		}
+		if _, ok := ring.keys[key.ID]; ok {
+			return nil, errors.Errorf("duplicate key ID %q", key.ID)
+		}
+		ring.keys[key.ID] = key
+	}
+
+	return ring, nil
+}
+
+// Empty reports whether there are no keys, so the metrics are not verified.
+func (k *Keyring) Empty() bool {
+	return k == nil || len(k.keys) == 0
+}
+
+// Secret returns the secret of the key if it exists and has not expired.
+func (k *Keyring) Secret(id string) (string, bool) {
+	if k == nil {
+		return "", false
+	}
+
+	key, ok := k.keys[id]
+	if !ok {
+		return "", false
+	}
+	if !key.Expires.IsZero() && !k.now().Before(key.Expires) {
+		return "", false
+	}
+	return key.Secret, true
+}
+
+// VerifyHashWithKeyring verifies the hash of the metric with the key referred by KeyID.
+// Nothing is verified if the keyring is empty.
+func (m *Metric) VerifyHashWithKeyring(keys *Keyring) error {
+	if keys.Empty() {
+		return nil
+	}
+
+	secret, ok := keys.Secret(m.KeyID)
+	if !ok {
+		return errors.Errorf("unknown or expired key %q", m.KeyID)
+	}
+
+	return m.VerifyHash(secret)
+}
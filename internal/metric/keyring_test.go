@@ -0,0 +1,85 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetric_VerifyHashWithKeyring(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	keys, err := NewKeyring(
+		Key{Secret: "legacy"},
+		Key{ID: "2023-04", Secret: "old", Expires: now.Add(time.Hour)},
+		Key{ID: "2023-05", Secret: "new"},
+		Key{ID: "2023-03", Secret: "expired", Expires: now},
+	)
+	require.NoError(t, err)
+	keys.now = func() time.Time { return now }
+
+	signed := func(keyID, secret string) *Metric {
+		m := NewGauge("Alloc", 1.5)
+		m.FillHash(secret)
+		m.KeyID = keyID
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		metric  *Metric
+		keys    *Keyring
+		wantErr bool
+	}{
+		{
+			name:   "metric without key ID",
+			metric: signed("", "legacy"),
+			keys:   keys,
+		},
+		{
+			name:   "old key during rotation",
+			metric: signed("2023-04", "old"),
+			keys:   keys,
+		},
+		{
+			name:   "new key during rotation",
+			metric: signed("2023-05", "new"),
+			keys:   keys,
+		},
+		{
+			name:    "expired key",
+			metric:  signed("2023-03", "expired"),
+			keys:    keys,
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			metric:  signed("2023-06", "new"),
+			keys:    keys,
+			wantErr: true,
+		},
+		{
+			name:    "hash of another key",
+			metric:  signed("2023-05", "old"),
+			keys:    keys,
+			wantErr: true,
+		},
+		{
+			name:   "empty keyring",
+			metric: NewGauge("Alloc", 1.5),
+			keys:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.metric.VerifyHashWithKeyring(tt.keys)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestNewKeyring_DuplicateID(t *testing.T) {
+	_, err := NewKeyring(Key{ID: "a", Secret: "1"}, Key{ID: "a", Secret: "2"})
+	assert.Error(t, err)
+}
@@ -29,6 +29,12 @@ type Metric struct {
 	Value *float64 `json:"value,omitempty" db:"value"`
 	Delta *int64   `json:"delta,omitempty" db:"delta"`
 	Hash  string   `json:"hash,omitempty" db:"-"`
+	// KeyID identifies the key the hash is calculated with.
+	KeyID string `json:"key_id,omitempty" db:"-"`
+	// Timestamp in Unix milliseconds and Nonce are covered by the hash to protect
+	// from replays, they are only set in transit.
+	Timestamp int64  `json:"timestamp,omitempty" db:"-"`
+	Nonce     string `json:"nonce,omitempty" db:"-"`
 }
 
 // NewGauge instantiates a new metric of type Gauge.
@@ -54,16 +60,16 @@ func FromProto(p *proto.Metric) *Metric {
 	if p.Mtype == proto.Metric_COUNTER {
 		mtype = Counter
 	}
-	hash := ""
-	if p.Hash != nil {
-		hash = *p.Hash
-	}
 	return &Metric{
 		ID:    p.Id,
 		MType: mtype,
 		Value: p.Value,
 		Delta: p.Delta,
-		Hash:  hash,
+		Hash:  p.GetHash(),
+		KeyID: p.GetKeyId(),
+
+		Timestamp: p.GetTimestamp(),
+		Nonce:     p.GetNonce(),
 	}
 }
 
@@ -73,6 +79,15 @@ func (m *Metric) ToProto() *proto.Metric {
 		Mtype: proto.Metric_UNSPECIFIED,
 		Hash:  &m.Hash,
 	}
+	if m.KeyID != "" {
+		res.KeyId = &m.KeyID
+	}
+	if m.Timestamp != 0 {
+		res.Timestamp = &m.Timestamp
+	}
+	if m.Nonce != "" {
+		res.Nonce = &m.Nonce
+	}
 
 	switch m.MType {
 	case Gauge:
@@ -151,17 +166,19 @@ func (m *Metric) String() string {
 	return string(res)
 }
 
-// FillHash fills hash of a metric.
+// FillHash fills hash of a metric. The key is unnamed, so KeyID is reset.
 func (m *Metric) FillHash(hashKey string) {
 	if hashKey == "" {
 		return
 	}
 
+	m.KeyID = ""
+
 	switch m.MType {
 	case Gauge:
-		m.Hash = getGaugeHash(m.ID, *m.Value, hashKey)
+		m.Hash = getGaugeHash(m.ID, *m.Value, m.stamp(), hashKey)
 	case Counter:
-		m.Hash = getCounterHash(m.ID, *m.Delta, hashKey)
+		m.Hash = getCounterHash(m.ID, *m.Delta, m.stamp(), hashKey)
 	}
 }
 
@@ -175,9 +192,9 @@ func (m *Metric) VerifyHash(hashKey string) error {
 
 	switch m.MType {
 	case Gauge:
-		isValid = m.Hash == getGaugeHash(m.ID, *m.Value, hashKey)
+		isValid = m.Hash == getGaugeHash(m.ID, *m.Value, m.stamp(), hashKey)
 	case Counter:
-		isValid = m.Hash == getCounterHash(m.ID, *m.Delta, hashKey)
+		isValid = m.Hash == getCounterHash(m.ID, *m.Delta, m.stamp(), hashKey)
 	}
 
 	if !isValid {
@@ -221,12 +238,20 @@ func TypeFromString(str string) (Type, error) {
 	}
 }
 
-func getGaugeHash(name string, value float64, hashKey string) string {
-	return hash(fmt.Sprintf("%s:gauge:%f", name, value), hashKey)
+// stamp is appended to the hashed data, the metrics without a stamp are hashed as before.
+func (m *Metric) stamp() string {
+	if m.Timestamp == 0 && m.Nonce == "" {
+		return ""
+	}
+	return fmt.Sprintf(":%d:%s", m.Timestamp, m.Nonce)
+}
+
+func getGaugeHash(name string, value float64, stamp string, hashKey string) string {
+	return hash(fmt.Sprintf("%s:gauge:%f", name, value)+stamp, hashKey)
 }
 
-func getCounterHash(name string, delta int64, hashKey string) string {
-	return hash(fmt.Sprintf("%s:counter:%d", name, delta), hashKey)
+func getCounterHash(name string, delta int64, stamp string, hashKey string) string {
+	return hash(fmt.Sprintf("%s:counter:%d", name, delta)+stamp, hashKey)
 }
 
 func hash(src string, key string) string {
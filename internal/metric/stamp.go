@@ -0,0 +1,35 @@
+package metric
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stamp returns copies of the metrics with the timestamp and a random nonce
+// shared by the batch, signed with the key.
+func Stamp(metrics []*Metric, key Key, now time.Time) ([]*Metric, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	nonce := hex.EncodeToString(raw)
+
+	res := make([]*Metric, 0, len(metrics))
+	for _, m := range metrics {
+		stamped := *m
+		stamped.Timestamp = now.UnixMilli()
+		stamped.Nonce = nonce
+		stamped.Hash = ""
+		stamped.KeyID = ""
+		if key.Secret != "" {
+			stamped.FillHash(key.Secret)
+			stamped.KeyID = key.ID
+		}
+		res = append(res, &stamped)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,31 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStamp(t *testing.T) {
+	key := Key{ID: "2023-05", Secret: "secret"}
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	original := []*Metric{NewCounter("PollCount", 5), NewGauge("Alloc", 1.5)}
+
+	stamped, err := Stamp(original, key, now)
+	require.NoError(t, err)
+	require.Len(t, stamped, 2)
+
+	for _, m := range stamped {
+		assert.Equal(t, now.UnixMilli(), m.Timestamp)
+		assert.Equal(t, stamped[0].Nonce, m.Nonce)
+		assert.Equal(t, key.ID, m.KeyID)
+		assert.NoError(t, m.VerifyHash(key.Secret))
+	}
+	assert.Zero(t, original[0].Timestamp, "the original metrics are not modified")
+
+	// The stamp is covered by the hash
+	stamped[0].Timestamp++
+	assert.Error(t, stamped[0].VerifyHash(key.Secret))
+}
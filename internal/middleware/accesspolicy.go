@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RouteGroup is a group of routes sharing the same access policy.
+type RouteGroup string
+
+const (
+	// GroupIngest are the routes to update metrics.
+	GroupIngest RouteGroup = "ingest"
+	// GroupRead are the routes to read metrics.
+	GroupRead RouteGroup = "read"
+	// GroupAdmin are the service routes, e.g. documentation and reflection.
+	GroupAdmin RouteGroup = "admin"
+	// GroupHealth are the health checks.
+	GroupHealth RouteGroup = "health"
+)
+
+var routeGroups = map[RouteGroup]bool{
+	GroupIngest: true,
+	GroupRead:   true,
+	GroupAdmin:  true,
+	GroupHealth: true,
+}
+
+// AccessPolicy restricts the access to route groups by the client network.
+//
+// A group without its own entry in the policy is restricted to the default
+// networks. A group with no networks, either its own or default, is open to everyone.
+type AccessPolicy struct {
+	defaults []*net.IPNet
+	groups   map[RouteGroup][]*net.IPNet
+	resolver ClientIPResolver
+}
+
+// NewAccessPolicy creates an access policy from the lists of CIDRs.
+func NewAccessPolicy(defaults []string, groups map[string][]string, resolver ClientIPResolver) (*AccessPolicy, error) {
+	defaultNetworks, err := ParseNetworks(defaults)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid trusted subnets")
+	}
+
+	groupNetworks := make(map[RouteGroup][]*net.IPNet, len(groups))
+	for name, list := range groups {
+		group := RouteGroup(name)
+		if !routeGroups[group] {
+			return nil, errors.Errorf("unknown route group %q", name)
+		}
+
+		networks, err := ParseNetworks(list)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid networks of the route group %q", name)
+		}
+		groupNetworks[group] = networks
+	}
+
+	return &AccessPolicy{
+		defaults: defaultNetworks,
+		groups:   groupNetworks,
+		resolver: resolver,
+	}, nil
+}
+
+// Allowed reports whether the client with the given IP may access the group.
+// A nil policy allows everything.
+func (p *AccessPolicy) Allowed(group RouteGroup, ip net.IP) bool {
+	if p == nil {
+		return true
+	}
+
+	networks, ok := p.groups[group]
+	if !ok {
+		networks = p.defaults
+	}
+	if len(networks) == 0 {
+		return true
+	}
+
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware rejects the requests of clients not allowed to access the group.
+func (p *AccessPolicy) Middleware(group RouteGroup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p == nil {
+			c.Next()
+			return
+		}
+
+		if !p.Allowed(group, p.resolver.ClientIP(c.Request)) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor rejects the unary calls of clients not allowed to access
+// the group of the method, groupOf maps the full method name to its group.
+func (p *AccessPolicy) UnaryServerInterceptor(groupOf func(fullMethod string) RouteGroup) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := p.checkGRPC(ctx, groupOf(info.FullMethod)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func (p *AccessPolicy) StreamServerInterceptor(groupOf func(fullMethod string) RouteGroup) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := p.checkGRPC(ss.Context(), groupOf(info.FullMethod)); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (p *AccessPolicy) checkGRPC(ctx context.Context, group RouteGroup) error {
+	if p == nil {
+		return nil
+	}
+
+	if !p.Allowed(group, p.resolver.GRPCClientIP(ctx)) {
+		return status.Error(codes.PermissionDenied, "access denied")
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessPolicy_Allowed(t *testing.T) {
+	policy, err := NewAccessPolicy(
+		[]string{"192.168.1.0/24", "fd00::/8"},
+		map[string][]string{
+			"admin":  {"10.0.0.1"},
+			"health": {},
+		},
+		ClientIPResolver{},
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		group RouteGroup
+		ip    string
+		want  bool
+	}{
+		{
+			name:  "IPv4 in the default subnets",
+			group: GroupIngest,
+			ip:    "192.168.1.5",
+			want:  true,
+		},
+		{
+			name:  "IPv6 in the default subnets",
+			group: GroupRead,
+			ip:    "fd00::1",
+			want:  true,
+		},
+		{
+			name:  "outside of the default subnets",
+			group: GroupIngest,
+			ip:    "192.168.2.5",
+			want:  false,
+		},
+		{
+			name:  "group networks override the defaults",
+			group: GroupAdmin,
+			ip:    "192.168.1.5",
+			want:  false,
+		},
+		{
+			name:  "single host of the group",
+			group: GroupAdmin,
+			ip:    "10.0.0.1",
+			want:  true,
+		},
+		{
+			name:  "open group",
+			group: GroupHealth,
+			ip:    "8.8.8.8",
+			want:  true,
+		},
+		{
+			name:  "unknown client",
+			group: GroupIngest,
+			ip:    "",
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Allowed(tt.group, net.ParseIP(tt.ip)))
+		})
+	}
+}
+
+func TestNewAccessPolicy_Invalid(t *testing.T) {
+	_, err := NewAccessPolicy([]string{"not a network"}, nil, ClientIPResolver{})
+	assert.Error(t, err)
+
+	_, err = NewAccessPolicy(nil, map[string][]string{"unknown": {"10.0.0.0/8"}}, ClientIPResolver{})
+	assert.Error(t, err)
+}
+
+func TestAccessPolicy_Middleware(t *testing.T) {
+	policy, err := NewAccessPolicy([]string{"192.168.1.0/24"}, nil, ClientIPResolver{})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/", policy.Middleware(GroupRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		realIP string
+		want   int
+	}{
+		{name: "trusted", realIP: "192.168.1.5", want: http.StatusOK},
+		{name: "untrusted", realIP: "192.168.2.5", want: http.StatusForbidden},
+		{name: "no header", realIP: "", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestAccessPolicy_UnaryServerInterceptor(t *testing.T) {
+	policy, err := NewAccessPolicy([]string{"192.168.1.0/24"}, nil, ClientIPResolver{PeerFallback: true})
+	require.NoError(t, err)
+
+	interceptor := policy.UnaryServerInterceptor(func(string) RouteGroup { return GroupIngest })
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	tests := []struct {
+		name     string
+		peer     string
+		realIP   string
+		wantCode codes.Code
+	}{
+		{name: "trusted peer", peer: "192.168.1.5:4000", wantCode: codes.OK},
+		{name: "untrusted peer", peer: "192.168.2.5:4000", wantCode: codes.PermissionDenied},
+		{name: "trusted metadata", peer: "192.168.2.5:4000", realIP: "192.168.1.5", wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tt.peer)
+			require.NoError(t, err)
+
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+			if tt.realIP != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-real-ip", tt.realIP))
+			}
+
+			_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/Alerting/UpdateMetrics"}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestAccessPolicy_Nil(t *testing.T) {
+	var policy *AccessPolicy
+	assert.True(t, policy.Allowed(GroupAdmin, nil))
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/denistakeda/alerting/internal/audit"
+)
+
+// AuditUnaryServerInterceptor records the unary calls of the admin group to the
+// audit log, the action is the full method name. It should follow
+// AuthUnaryServerInterceptor, so the caller is known. A nil log records nothing.
+func AuditUnaryServerInterceptor(
+	log *audit.Log,
+	resolver ClientIPResolver,
+	groupOf func(fullMethod string) RouteGroup,
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if log == nil || groupOf(info.FullMethod) != GroupAdmin {
+			return handler(ctx, req)
+		}
+
+		resp, err := handler(ctx, req)
+		recordGRPC(ctx, log, resolver, info.FullMethod, err)
+
+		return resp, err
+	}
+}
+
+// AuditStreamServerInterceptor is the streaming counterpart of AuditUnaryServerInterceptor,
+// the stream is recorded once it is over. It should follow AuthStreamServerInterceptor.
+func AuditStreamServerInterceptor(
+	log *audit.Log,
+	resolver ClientIPResolver,
+	groupOf func(fullMethod string) RouteGroup,
+) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if log == nil || groupOf(info.FullMethod) != GroupAdmin {
+			return handler(srv, ss)
+		}
+
+		err := handler(srv, ss)
+		recordGRPC(ss.Context(), log, resolver, info.FullMethod, err)
+
+		return err
+	}
+}
+
+func recordGRPC(ctx context.Context, log *audit.Log, resolver ClientIPResolver, fullMethod string, err error) {
+	outcome, details := audit.OutcomeSuccess, ""
+	if err != nil {
+		outcome, details = audit.OutcomeFailure, status.Convert(err).Message()
+	}
+	log.Record(ctx, resolver.GRPCClientIP(ctx), fullMethod, "", outcome, details)
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/denistakeda/alerting/internal/auth"
+)
+
+// groupScopes are the scopes required to access the route groups,
+// the groups which are not listed do not require authentication.
+var groupScopes = map[RouteGroup]auth.Scope{
+	GroupIngest: auth.ScopeWrite,
+	GroupRead:   auth.ScopeRead,
+	GroupAdmin:  auth.ScopeAdmin,
+}
+
+// Authenticate rejects the requests without a bearer token having the scope of the group.
+// The token is put into the request context. A nil authenticator allows everything.
+func Authenticate(authenticator *auth.Authenticator, group RouteGroup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope, ok := groupScopes[group]
+		if authenticator == nil || !ok {
+			c.Next()
+			return
+		}
+
+		token, err := authenticator.Authorize(c.Request.Context(), bearerToken(c.GetHeader("Authorization")), scope)
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		case errors.Is(err, auth.ErrForbidden):
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		case err != nil:
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), token))
+		c.Next()
+	}
+}
+
+// AuthUnaryServerInterceptor is the gRPC counterpart of Authenticate, the token
+// is taken from the authorization metadata. groupOf maps the full method name to its group.
+func AuthUnaryServerInterceptor(
+	authenticator *auth.Authenticator,
+	groupOf func(fullMethod string) RouteGroup,
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		token, err := authorizeGRPC(ctx, authenticator, groupOf(info.FullMethod))
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			ctx = auth.NewContext(ctx, token)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamServerInterceptor is the streaming counterpart of AuthUnaryServerInterceptor.
+func AuthStreamServerInterceptor(
+	authenticator *auth.Authenticator,
+	groupOf func(fullMethod string) RouteGroup,
+) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		token, err := authorizeGRPC(ss.Context(), authenticator, groupOf(info.FullMethod))
+		if err != nil {
+			return err
+		}
+		if token != nil {
+			ss = &contextStream{ServerStream: ss, ctx: auth.NewContext(ss.Context(), token)}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// contextStream replaces the context of a stream, so the interceptors can pass values down.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func authorizeGRPC(ctx context.Context, authenticator *auth.Authenticator, group RouteGroup) (*auth.Token, error) {
+	scope, ok := groupScopes[group]
+	if authenticator == nil || !ok {
+		return nil, nil
+	}
+
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	token, err := authenticator.Authorize(ctx, bearerToken(header), scope)
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	case errors.Is(err, auth.ErrForbidden):
+		return nil, status.Errorf(codes.PermissionDenied, "token does not have the %s scope", scope)
+	case err != nil:
+		return nil, status.Error(codes.Internal, "unable to authorize")
+	}
+	return token, nil
+}
+
+func bearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
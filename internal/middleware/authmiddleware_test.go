@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/denistakeda/alerting/internal/auth"
+)
+
+type tokenMap map[string]*auth.Token
+
+func (m tokenMap) TokenByHash(_ context.Context, hash string) (*auth.Token, bool) {
+	token, ok := m[hash]
+	return token, ok
+}
+
+func newTestAuthenticator(t *testing.T) (*auth.Authenticator, string) {
+	token, secret, err := auth.NewToken("agent", auth.Scopes{auth.ScopeWrite})
+	require.NoError(t, err)
+	return auth.NewAuthenticator(tokenMap{token.Hash: token}, ""), secret
+}
+
+func TestAuthenticate(t *testing.T) {
+	authenticator, secret := newTestAuthenticator(t)
+
+	r := gin.New()
+	r.POST("/updates/", Authenticate(authenticator, GroupIngest), func(c *gin.Context) {
+		token, ok := auth.FromContext(c.Request.Context())
+		require.True(t, ok)
+		c.String(http.StatusOK, token.Name)
+	})
+	r.GET("/value/", Authenticate(authenticator, GroupRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/ping", Authenticate(authenticator, GroupHealth), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		want   int
+	}{
+		{name: "granted", method: http.MethodPost, path: "/updates/", header: "Bearer " + secret, want: http.StatusOK},
+		{name: "missing scope", method: http.MethodGet, path: "/value/", header: "Bearer " + secret, want: http.StatusForbidden},
+		{name: "no token", method: http.MethodPost, path: "/updates/", want: http.StatusUnauthorized},
+		{name: "wrong scheme", method: http.MethodPost, path: "/updates/", header: "Basic " + secret, want: http.StatusUnauthorized},
+		{name: "health is open", method: http.MethodGet, path: "/ping", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestAuthUnaryServerInterceptor(t *testing.T) {
+	authenticator, secret := newTestAuthenticator(t)
+
+	interceptor := AuthUnaryServerInterceptor(authenticator, func(string) RouteGroup { return GroupIngest })
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, ok := auth.FromContext(ctx)
+		assert.True(t, ok)
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/Alerting/UpdateMetrics"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+secret))
+	_, err := interceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+
+	_, err = interceptor(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
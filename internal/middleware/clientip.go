@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ParseNetworks parses a list of CIDRs, a plain address is treated as a single host network.
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, errors.Errorf("invalid address %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid network %q", item)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ClientIPResolver determines the IP address of the client.
+//
+// The X-Real-IP header set by the agent is used first. X-Forwarded-For is only
+// honored if the request comes from one of TrustedProxies, the rightmost address
+// which is not a trusted proxy is taken. If PeerFallback is set, the address of
+// the TCP peer is used when the headers do not provide one.
+//
+// If ProxiedRealIP is set, X-Real-IP is only honored from TrustedProxies as well,
+// so the clients can not choose their address, e.g. to evade the rate limits.
+type ClientIPResolver struct {
+	TrustedProxies []*net.IPNet
+	PeerFallback   bool
+	ProxiedRealIP  bool
+}
+
+// ClientIP returns the IP address of the client or nil if it can not be determined.
+func (r ClientIPResolver) ClientIP(req *http.Request) net.IP {
+	return r.resolve(req.Header.Get("X-Real-IP"), req.Header.Get("X-Forwarded-For"), req.RemoteAddr)
+}
+
+// GRPCClientIP returns the IP address of the gRPC client or nil if it can not be determined.
+// The x-real-ip and x-forwarded-for metadata are treated as the corresponding headers.
+func (r ClientIPResolver) GRPCClientIP(ctx context.Context) net.IP {
+	var realIP, forwardedFor, remoteAddr string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-real-ip"); len(values) > 0 {
+			realIP = values[0]
+		}
+		forwardedFor = strings.Join(md.Get("x-forwarded-for"), ",")
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	return r.resolve(realIP, forwardedFor, remoteAddr)
+}
+
+func (r ClientIPResolver) resolve(realIP, forwardedFor, remoteAddr string) net.IP {
+	peer := peerIP(remoteAddr)
+	trustedPeer := peer != nil && r.isTrustedProxy(peer)
+
+	if !r.ProxiedRealIP || trustedPeer {
+		if ip := net.ParseIP(strings.TrimSpace(realIP)); ip != nil {
+			return ip
+		}
+	}
+
+	if trustedPeer {
+		forwarded := strings.Split(forwardedFor, ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+			if ip == nil {
+				break
+			}
+			if !r.isTrustedProxy(ip) {
+				return ip
+			}
+		}
+	}
+
+	if r.PeerFallback {
+		return peer
+	}
+
+	return nil
+}
+
+func (r ClientIPResolver) isTrustedProxy(ip net.IP) bool {
+	for _, proxy := range r.TrustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func peerIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPResolver_ClientIP(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		resolver   ClientIPResolver
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "X-Real-IP",
+			resolver:   ClientIPResolver{},
+			remoteAddr: "192.168.1.1:5000",
+			headers:    map[string]string{"X-Real-IP": "192.168.1.2"},
+			want:       "192.168.1.2",
+		},
+		{
+			name:       "no headers without fallback",
+			resolver:   ClientIPResolver{},
+			remoteAddr: "192.168.1.1:5000",
+			want:       "",
+		},
+		{
+			name:       "peer fallback",
+			resolver:   ClientIPResolver{PeerFallback: true},
+			remoteAddr: "192.168.1.1:5000",
+			want:       "192.168.1.1",
+		},
+		{
+			name:       "X-Forwarded-For from trusted proxy",
+			resolver:   ClientIPResolver{TrustedProxies: []*net.IPNet{proxies}},
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 192.168.1.3, 10.0.0.2"},
+			want:       "192.168.1.3",
+		},
+		{
+			name:       "X-Forwarded-For from untrusted peer",
+			resolver:   ClientIPResolver{TrustedProxies: []*net.IPNet{proxies}, PeerFallback: true},
+			remoteAddr: "192.168.1.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "192.168.1.3"},
+			want:       "192.168.1.1",
+		},
+		{
+			name:       "proxied X-Real-IP from trusted proxy",
+			resolver:   ClientIPResolver{TrustedProxies: []*net.IPNet{proxies}, PeerFallback: true, ProxiedRealIP: true},
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Real-IP": "192.168.1.2"},
+			want:       "192.168.1.2",
+		},
+		{
+			name:       "proxied X-Real-IP from untrusted peer",
+			resolver:   ClientIPResolver{TrustedProxies: []*net.IPNet{proxies}, PeerFallback: true, ProxiedRealIP: true},
+			remoteAddr: "192.168.1.1:5000",
+			headers:    map[string]string{"X-Real-IP": "192.168.1.2"},
+			want:       "192.168.1.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/updates/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			got := tt.resolver.ClientIP(req)
+			if tt.want == "" {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
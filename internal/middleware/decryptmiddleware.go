@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/encryption"
+)
+
+// MaxBodySize limits the size of the bodies read into memory to be decrypted or verified.
+const MaxBodySize = 32 << 20
+
+// DecryptMiddleware decrypts the bodies encrypted with the public key of the server.
+// The bodies of the ingest group must be encrypted, the requests of the other groups
+// without the encryption Content-Encoding are passed as is. Nothing is decrypted if
+// privateKey is nil.
+func DecryptMiddleware(privateKey *rsa.PrivateKey, group RouteGroup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if privateKey == nil {
+			c.Next()
+			return
+		}
+
+		if c.Request.Header.Get("Content-Encoding") != encryption.ContentEncoding {
+			if group == GroupIngest && c.Request.ContentLength != 0 {
+				c.AbortWithStatus(http.StatusUnsupportedMediaType)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		encrypted, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+				return
+			}
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		body, err := encryption.Decrypt(privateKey, encrypted)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Del("Content-Encoding")
+
+		c.Next()
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/encryption"
+)
+
+func TestDecryptMiddleware(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":5}]`)
+	encrypted, err := encryption.Encrypt(&priv.PublicKey, body)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		key      *rsa.PrivateKey
+		group    RouteGroup
+		body     []byte
+		encoding string
+		wantCode int
+		wantBody []byte
+	}{
+		{
+			name:     "encrypted body",
+			key:      priv,
+			group:    GroupIngest,
+			body:     encrypted,
+			encoding: encryption.ContentEncoding,
+			wantCode: http.StatusOK,
+			wantBody: body,
+		},
+		{
+			name:     "plain ingest body",
+			key:      priv,
+			group:    GroupIngest,
+			body:     body,
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "empty ingest body",
+			key:      priv,
+			group:    GroupIngest,
+			body:     []byte{},
+			wantCode: http.StatusOK,
+			wantBody: []byte{},
+		},
+		{
+			name:     "plain read body",
+			key:      priv,
+			group:    GroupRead,
+			body:     body,
+			wantCode: http.StatusOK,
+			wantBody: body,
+		},
+		{
+			name:     "plain body without the key",
+			group:    GroupIngest,
+			body:     body,
+			wantCode: http.StatusOK,
+			wantBody: body,
+		},
+		{
+			name:     "corrupted body",
+			key:      priv,
+			group:    GroupIngest,
+			body:     body,
+			encoding: encryption.ContentEncoding,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "too large body",
+			key:      priv,
+			group:    GroupIngest,
+			body:     make([]byte, MaxBodySize+1),
+			encoding: encryption.ContentEncoding,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			r := gin.New()
+			r.Use(DecryptMiddleware(tt.key, tt.group))
+			r.POST("/updates/", func(c *gin.Context) {
+				got, err = io.ReadAll(c.Request.Body)
+				require.NoError(t, err)
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != nil {
+				assert.Equal(t, tt.wantBody, got)
+			}
+		})
+	}
+}
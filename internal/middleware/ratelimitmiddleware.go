@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/denistakeda/alerting/internal/auth"
+	"github.com/denistakeda/alerting/internal/ratelimit"
+)
+
+// RateLimit limits the requests of the ingest group. The clients are told apart
+// by their token or, if not authenticated, by their IP address, so it should
+// follow Authenticate. The key of the client is put into the request context,
+// so the handler can limit the metrics as well. A nil limiter allows everything.
+func RateLimit(limiter *ratelimit.Limiter, resolver ClientIPResolver, group RouteGroup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || group != GroupIngest {
+			c.Next()
+			return
+		}
+
+		ctx := ratelimit.NewContext(c.Request.Context(), clientKey(c.Request.Context(), resolver.ClientIP(c.Request).String()))
+		c.Request = c.Request.WithContext(ctx)
+
+		if wait, ok := limiter.AllowRequest(ctx); !ok {
+			c.Header("Retry-After", ratelimit.RetryAfter(wait))
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RateLimitUnaryServerInterceptor is the gRPC counterpart of RateLimit, it should
+// follow AuthUnaryServerInterceptor. groupOf maps the full method name to its group.
+func RateLimitUnaryServerInterceptor(
+	limiter *ratelimit.Limiter,
+	resolver ClientIPResolver,
+	groupOf func(fullMethod string) RouteGroup,
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if limiter == nil || groupOf(info.FullMethod) != GroupIngest {
+			return handler(ctx, req)
+		}
+
+		ctx = ratelimit.NewContext(ctx, clientKey(ctx, resolver.GRPCClientIP(ctx).String()))
+		if wait, ok := limiter.AllowRequest(ctx); !ok {
+			return nil, ResourceExhausted(ctx, wait)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// ResourceExhausted returns the gRPC error of a rate-limited call, the time to
+// wait is sent in the retry-after header.
+func ResourceExhausted(ctx context.Context, wait time.Duration) error {
+	retryAfter := ratelimit.RetryAfter(wait)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ss", retryAfter)
+}
+
+func clientKey(ctx context.Context, ip string) string {
+	if token, ok := auth.FromContext(ctx); ok {
+		return "token:" + token.ID
+	}
+	return "ip:" + ip
+}
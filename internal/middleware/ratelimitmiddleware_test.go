@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.Limits{RequestRate: 1, RequestBurst: 1})
+
+	r := gin.New()
+	r.POST("/updates/", RateLimit(limiter, ClientIPResolver{}, GroupIngest), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/", RateLimit(limiter, ClientIPResolver{}, GroupRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(method, url, realIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("X-Real-IP", realIP)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/updates/", "10.0.0.1").Code)
+
+	w := send(http.MethodPost, "/updates/", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/updates/", "10.0.0.2").Code, "another client")
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/", "10.0.0.1").Code, "only ingest is limited")
+}
+
+func TestRateLimit_SpoofedRealIP(t *testing.T) {
+	proxies, err := ParseNetworks([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	resolver := ClientIPResolver{TrustedProxies: proxies, PeerFallback: true, ProxiedRealIP: true}
+	limiter := ratelimit.New(ratelimit.Limits{RequestRate: 1, RequestBurst: 1})
+
+	r := gin.New()
+	r.POST("/updates/", RateLimit(limiter, resolver, GroupIngest), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(remoteAddr, realIP string) int {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Real-IP", realIP)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// An untrusted peer shares its bucket whatever address it reports
+	assert.Equal(t, http.StatusOK, send("192.168.1.1:5000", "172.16.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, send("192.168.1.1:5000", "172.16.0.2"))
+	assert.Equal(t, 1, limiter.Stats().Clients)
+
+	// The clients behind a trusted proxy are told apart by the reported address
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:5000", "172.16.0.1"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:5000", "172.16.0.2"))
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// bodySignedKey marks the requests which body signature was verified.
+const bodySignedKey = "body_signed"
+
+// VerifyBodySignature verifies the signature of the whole body sent in the
+// metric.BatchHashHeader header, the key is selected by the metric.BatchKeyIDHeader
+// header. The requests without the signature are passed as is, as well as all
+// the requests if there are no keys.
+func VerifyBodySignature(keys *metric.Keyring) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		signature := c.GetHeader(metric.BatchHashHeader)
+		if signature == "" || keys.Empty() {
+			c.Next()
+			return
+		}
+
+		secret, ok := keys.Secret(c.GetHeader(metric.BatchKeyIDHeader))
+		if !ok {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+				return
+			}
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if !metric.VerifyBatchHash(body, secret, signature) {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Set(bodySignedKey, true)
+
+		c.Next()
+	}
+}
+
+// BodySigned reports whether the body signature of the request was verified,
+// so the items of the body do not need to be verified one by one.
+func BodySigned(c *gin.Context) bool {
+	return c.GetBool(bodySignedKey)
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+func TestVerifyBodySignature(t *testing.T) {
+	keys, err := metric.NewKeyring(metric.Key{Secret: "legacy"}, metric.Key{ID: "2023-05", Secret: "new"})
+	require.NoError(t, err)
+
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+
+	tests := []struct {
+		name       string
+		keys       *metric.Keyring
+		headers    map[string]string
+		wantStatus int
+		wantSigned bool
+	}{
+		{
+			name:       "signed with the default key",
+			keys:       keys,
+			headers:    map[string]string{metric.BatchHashHeader: metric.BatchHash(body, "legacy")},
+			wantStatus: http.StatusOK,
+			wantSigned: true,
+		},
+		{
+			name: "signed with a key ID",
+			keys: keys,
+			headers: map[string]string{
+				metric.BatchHashHeader:  metric.BatchHash(body, "new"),
+				metric.BatchKeyIDHeader: "2023-05",
+			},
+			wantStatus: http.StatusOK,
+			wantSigned: true,
+		},
+		{
+			name:       "not signed",
+			keys:       keys,
+			wantStatus: http.StatusOK,
+			wantSigned: false,
+		},
+		{
+			name:       "wrong signature",
+			keys:       keys,
+			headers:    map[string]string{metric.BatchHashHeader: metric.BatchHash(body, "other")},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "unknown key ID",
+			keys: keys,
+			headers: map[string]string{
+				metric.BatchHashHeader:  metric.BatchHash(body, "new"),
+				metric.BatchKeyIDHeader: "2023-06",
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "no keys on the server",
+			keys:       nil,
+			headers:    map[string]string{metric.BatchHashHeader: "garbage"},
+			wantStatus: http.StatusOK,
+			wantSigned: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/updates/", VerifyBodySignature(tt.keys), func(c *gin.Context) {
+				received, err := io.ReadAll(c.Request.Body)
+				require.NoError(t, err)
+				assert.Equal(t, body, received)
+				assert.Equal(t, tt.wantSigned, BodySigned(c))
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestVerifyBodySignature_TooLarge(t *testing.T) {
+	keys, err := metric.NewKeyring(metric.Key{Secret: "legacy"})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.POST("/updates/", VerifyBodySignature(keys), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	body := make([]byte, MaxBodySize+1)
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+	req.Header.Set(metric.BatchHashHeader, metric.BatchHash(body, "legacy"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
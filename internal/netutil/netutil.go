@@ -0,0 +1,50 @@
+// Package netutil contains network helpers shared by the clients.
+package netutil
+
+import (
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OutboundIP returns the address of the local interface used to reach the given host:port.
+func OutboundIP(address string) (net.IP, error) {
+	// No packets are sent, dialing UDP only selects the route
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to find the route to the server")
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// RealIP is the address of the client reported to the server, either configured
+// or detected. The server may be unreachable when the client is created, so the
+// detection is retried on every use until it succeeds.
+type RealIP struct {
+	detect func() (net.IP, error)
+
+	mx sync.Mutex
+	ip string
+}
+
+// NewRealIP returns the configured address, detected with detect if empty.
+func NewRealIP(configured string, detect func() (net.IP, error)) *RealIP {
+	return &RealIP{detect: detect, ip: configured}
+}
+
+// Get returns the address, or an empty string if it is not detected yet.
+func (r *RealIP) Get() string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.ip == "" {
+		if ip, err := r.detect(); err == nil {
+			r.ip = ip.String()
+		}
+	}
+
+	return r.ip
+}
@@ -0,0 +1,37 @@
+package netutil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIP_Get(t *testing.T) {
+	t.Run("configured address", func(t *testing.T) {
+		r := NewRealIP("192.168.1.10", func() (net.IP, error) {
+			t.Fatal("configured address must not be detected")
+			return nil, nil
+		})
+
+		assert.Equal(t, "192.168.1.10", r.Get())
+	})
+
+	t.Run("detection is retried until it succeeds", func(t *testing.T) {
+		calls := 0
+		r := NewRealIP("", func() (net.IP, error) {
+			calls++
+			if calls < 3 {
+				return nil, errors.New("network is unreachable")
+			}
+			return net.ParseIP("10.0.0.5"), nil
+		})
+
+		assert.Equal(t, "", r.Get())
+		assert.Equal(t, "", r.Get())
+		assert.Equal(t, "10.0.0.5", r.Get())
+		assert.Equal(t, "10.0.0.5", r.Get())
+		assert.Equal(t, 3, calls)
+	})
+}
@@ -1,6 +1,47 @@
 package ports
 
-import "github.com/denistakeda/alerting/internal/metric"
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+// ErrSeriesLimit is matched by SeriesLimitError.
+var ErrSeriesLimit = errors.New("series limit exceeded")
+
+// Series identifies the metrics of the same type and name.
+type Series struct {
+	Type metric.Type `json:"type"`
+	ID   string      `json:"id"`
+}
+
+// SeriesLimitError is returned by the clients if the server rejected the new
+// series of the batch because of its cardinality limits. The other metrics
+// of the batch were stored, so the batch must not be sent again.
+type SeriesLimitError struct {
+	Rejected []Series
+}
+
+func (e *SeriesLimitError) Error() string {
+	return fmt.Sprintf("%v, rejected %d new series", ErrSeriesLimit, len(e.Rejected))
+}
+
+// Is makes the error match ErrSeriesLimit.
+func (e *SeriesLimitError) Is(target error) bool {
+	return target == ErrSeriesLimit
+}
+
+// Rejects reports whether the series was rejected.
+func (e *SeriesLimitError) Rejects(t metric.Type, id string) bool {
+	for _, series := range e.Rejected {
+		if series.Type == t && series.ID == id {
+			return true
+		}
+	}
+	return false
+}
 
 type Client interface {
 	SendMetrics([]*metric.Metric) error
@@ -0,0 +1,207 @@
+// Package ratelimit limits the ingestion rate of the clients with token buckets.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits are the rates and bursts allowed to every client, a zero rate is unlimited.
+// If the burst is zero, it is equal to the rate of one second.
+type Limits struct {
+	// RequestRate is the number of requests per second.
+	RequestRate  float64
+	RequestBurst int
+	// MetricRate is the number of metrics per second.
+	MetricRate  float64
+	MetricBurst int
+}
+
+// Stats are the counters of the rejected requests.
+type Stats struct {
+	// RejectedRequests were rejected by the request rate.
+	RejectedRequests int64 `json:"rejected_requests"`
+	// RejectedBatches were rejected by the metric rate.
+	RejectedBatches int64 `json:"rejected_batches"`
+	// Clients is the number of clients being tracked.
+	Clients int `json:"clients"`
+}
+
+// sweepInterval is how often the clients with full buckets are forgotten.
+const sweepInterval = time.Minute
+
+// Limiter keeps a pair of token buckets for every client.
+type Limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mx        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+
+	rejectedRequests atomic.Int64
+	rejectedBatches  atomic.Int64
+}
+
+type client struct {
+	requests *bucket
+	metrics  *bucket
+}
+
+// New instantiates a new Limiter.
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		now:     time.Now,
+		clients: make(map[string]*client),
+	}
+}
+
+// AllowRequest takes a request from the bucket of the client of the context.
+// If the request is not allowed, the time to wait before retrying is returned.
+// A nil Limiter allows everything.
+func (l *Limiter) AllowRequest(ctx context.Context) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+
+	wait, ok := l.take(ctx, func(c *client) *bucket { return c.requests }, 1)
+	if !ok {
+		l.rejectedRequests.Add(1)
+	}
+	return wait, ok
+}
+
+// AllowMetrics takes n metrics from the bucket of the client of the context.
+// If the metrics are not allowed, the time to wait before retrying is returned.
+// A nil Limiter allows everything.
+func (l *Limiter) AllowMetrics(ctx context.Context, n int) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+
+	wait, ok := l.take(ctx, func(c *client) *bucket { return c.metrics }, n)
+	if !ok {
+		l.rejectedBatches.Add(1)
+	}
+	return wait, ok
+}
+
+// Stats returns the counters of the rejected requests.
+func (l *Limiter) Stats() Stats {
+	l.mx.Lock()
+	clients := len(l.clients)
+	l.mx.Unlock()
+
+	return Stats{
+		RejectedRequests: l.rejectedRequests.Load(),
+		RejectedBatches:  l.rejectedBatches.Load(),
+		Clients:          clients,
+	}
+}
+
+func (l *Limiter) take(ctx context.Context, pick func(*client) *bucket, n int) (time.Duration, bool) {
+	key, _ := FromContext(ctx)
+	now := l.now()
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	c, ok := l.clients[key]
+	if !ok {
+		l.sweep(now)
+		c = &client{
+			requests: newBucket(l.limits.RequestRate, l.limits.RequestBurst, now),
+			metrics:  newBucket(l.limits.MetricRate, l.limits.MetricBurst, now),
+		}
+		l.clients[key] = c
+	}
+
+	return pick(c).take(n, now)
+}
+
+// sweep forgets the clients with full buckets, they are the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, c := range l.clients {
+		if c.requests.full(now) && c.metrics.full(now) {
+			delete(l.clients, key)
+		}
+	}
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &bucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+func (b *bucket) full(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *bucket) take(n int, now time.Time) (time.Duration, bool) {
+	if b.rate <= 0 {
+		return 0, true
+	}
+	b.refill(now)
+
+	// A batch larger than the burst is allowed on a full bucket, otherwise it
+	// would never pass. The debt delays the following requests.
+	need := math.Min(float64(n), b.burst)
+	if b.tokens >= need {
+		b.tokens -= float64(n)
+		return 0, true
+	}
+
+	wait := time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+	return wait, false
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the key the client is limited by.
+func NewContext(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the key the client is limited by.
+func FromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(contextKey{}).(string)
+	return key, ok
+}
+
+// RetryAfter returns the value of the Retry-After header, in whole seconds.
+func RetryAfter(wait time.Duration) string {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(limits Limits) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	l := New(limits)
+	l.now = clock.Now
+	return l, clock
+}
+
+func TestLimiter_AllowRequest(t *testing.T) {
+	l, clock := newTestLimiter(Limits{RequestRate: 2, RequestBurst: 3})
+	ctx := NewContext(context.Background(), "ip:10.0.0.1")
+
+	for i := 0; i < 3; i++ {
+		_, ok := l.AllowRequest(ctx)
+		assert.True(t, ok, "request %d within the burst", i)
+	}
+
+	wait, ok := l.AllowRequest(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	_, ok = l.AllowRequest(ctx)
+	assert.True(t, ok)
+
+	assert.Equal(t, int64(1), l.Stats().RejectedRequests)
+}
+
+func TestLimiter_AllowMetrics(t *testing.T) {
+	l, clock := newTestLimiter(Limits{MetricRate: 10, MetricBurst: 10})
+	ctx := NewContext(context.Background(), "token:abc")
+
+	// A batch larger than the burst passes on a full bucket and leaves a debt
+	_, ok := l.AllowMetrics(ctx, 15)
+	assert.True(t, ok)
+
+	wait, ok := l.AllowMetrics(ctx, 1)
+	assert.False(t, ok)
+	assert.Equal(t, 600*time.Millisecond, wait)
+
+	clock.now = clock.now.Add(600 * time.Millisecond)
+	_, ok = l.AllowMetrics(ctx, 1)
+	assert.True(t, ok)
+
+	assert.Equal(t, int64(1), l.Stats().RejectedBatches)
+}
+
+func TestLimiter_Clients(t *testing.T) {
+	l, clock := newTestLimiter(Limits{RequestRate: 1, RequestBurst: 1})
+	first := NewContext(context.Background(), "ip:10.0.0.1")
+	second := NewContext(context.Background(), "ip:10.0.0.2")
+
+	_, ok := l.AllowRequest(first)
+	assert.True(t, ok)
+	_, ok = l.AllowRequest(first)
+	assert.False(t, ok)
+	_, ok = l.AllowRequest(second)
+	assert.True(t, ok, "the clients have their own buckets")
+	assert.Equal(t, 2, l.Stats().Clients)
+
+	// Idle clients are forgotten once their buckets are full again
+	clock.now = clock.now.Add(2 * sweepInterval)
+	_, ok = l.AllowRequest(NewContext(context.Background(), "ip:10.0.0.3"))
+	assert.True(t, ok)
+	assert.Equal(t, 1, l.Stats().Clients)
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	l, _ := newTestLimiter(Limits{RequestRate: 1})
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		_, ok := l.AllowMetrics(ctx, 1000)
+		assert.True(t, ok)
+	}
+
+	var nilLimiter *Limiter
+	_, ok := nilLimiter.AllowRequest(ctx)
+	assert.True(t, ok)
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{wait: 0, want: "1"},
+		{wait: 200 * time.Millisecond, want: "1"},
+		{wait: time.Second, want: "1"},
+		{wait: 1500 * time.Millisecond, want: "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wait.String(), func(t *testing.T) {
+			assert.Equal(t, tt.want, RetryAfter(tt.wait))
+		})
+	}
+}
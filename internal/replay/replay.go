@@ -0,0 +1,175 @@
+// Package replay protects the server from the replayed metric updates.
+package replay
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+var (
+	// ErrNoStamp is returned if the metric has no timestamp or nonce.
+	ErrNoStamp = errors.New("metric has no timestamp or nonce")
+	// ErrStale is returned if the timestamp is outside of the clock-skew window.
+	ErrStale = errors.New("metric timestamp is outside of the allowed window")
+	// ErrReplayed is returned if the nonce was already seen for the metric.
+	ErrReplayed = errors.New("metric was already received")
+	// ErrFull is returned if there is no room to remember the nonces, the metrics
+	// should be resent later.
+	ErrFull = errors.New("too many nonces to remember")
+)
+
+// RetryAfter is the time to resend the metrics rejected with ErrFull, some of
+// the nonces expire meanwhile.
+const RetryAfter = time.Second
+
+// Guard rejects the metrics with a timestamp outside of the clock-skew window
+// or with a nonce seen recently. The nonces are remembered until they leave the
+// window, at most size of them. The new metrics are rejected while the cache is
+// full, forgetting the nonces early would let the metrics be replayed.
+type Guard struct {
+	window time.Duration
+	size   int
+	now    func() time.Time
+
+	mx   sync.Mutex
+	seen map[string]*nonce
+	// expiry orders the nonces by their expiration, the clocks of the clients
+	// may differ, so they do not expire in the order they are received
+	expiry expiryHeap
+}
+
+type nonce struct {
+	key     string
+	expires time.Time
+	index   int
+}
+
+// New instantiates a new Guard.
+func New(window time.Duration, size int) *Guard {
+	return &Guard{
+		window: window,
+		size:   size,
+		now:    time.Now,
+		seen:   make(map[string]*nonce, size),
+		expiry: make(expiryHeap, 0, size),
+	}
+}
+
+// Accepted are the nonces remembered by Accept.
+type Accepted struct {
+	g    *Guard
+	keys []string
+}
+
+// Forget forgets the nonces, so the metrics are accepted again if resent,
+// e.g. when they failed to be stored.
+func (a Accepted) Forget() {
+	if a.g == nil || len(a.keys) == 0 {
+		return
+	}
+
+	a.g.mx.Lock()
+	defer a.g.mx.Unlock()
+
+	for _, key := range a.keys {
+		if n, ok := a.g.seen[key]; ok {
+			heap.Remove(&a.g.expiry, n.index)
+			delete(a.g.seen, key)
+		}
+	}
+}
+
+// Accept checks the stamps of the metrics and removes them, as they are only
+// meaningful in transit. Either all the metrics are accepted or none of them.
+// The hashes should be verified before, so the stamps can be trusted.
+// A nil Guard accepts everything.
+func (g *Guard) Accept(metrics ...*metric.Metric) (Accepted, error) {
+	if g == nil {
+		return Accepted{}, nil
+	}
+
+	now := g.now()
+	keys := make([]string, 0, len(metrics))
+	expires := make([]time.Time, 0, len(metrics))
+	for _, m := range metrics {
+		if m.Timestamp == 0 || m.Nonce == "" {
+			return Accepted{}, errors.Wrapf(ErrNoStamp, "metric %s", m.ID)
+		}
+
+		ts := time.UnixMilli(m.Timestamp)
+		if ts.Before(now.Add(-g.window)) || ts.After(now.Add(g.window)) {
+			return Accepted{}, errors.Wrapf(ErrStale, "metric %s", m.ID)
+		}
+
+		// The nonce is shared by a batch, so it is unique only along with the metric
+		keys = append(keys, m.KeyID+"\x00"+m.Nonce+"\x00"+string(m.MType)+"\x00"+m.ID)
+		// A replay outside of the window is rejected as stale, so the nonce
+		// is only needed until then
+		expires = append(expires, ts.Add(g.window))
+	}
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	g.evict(now)
+	batch := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		if _, ok := g.seen[key]; ok || batch[key] {
+			return Accepted{}, errors.Wrapf(ErrReplayed, "metric %s", metrics[i].ID)
+		}
+		batch[key] = true
+	}
+	if len(g.seen)+len(keys) > g.size {
+		return Accepted{}, ErrFull
+	}
+	for i, key := range keys {
+		n := &nonce{key: key, expires: expires[i]}
+		heap.Push(&g.expiry, n)
+		g.seen[key] = n
+	}
+
+	for _, m := range metrics {
+		m.Timestamp = 0
+		m.Nonce = ""
+	}
+	return Accepted{g: g, keys: keys}, nil
+}
+
+func (g *Guard) evict(now time.Time) {
+	for len(g.expiry) > 0 && !now.Before(g.expiry[0].expires) {
+		n := heap.Pop(&g.expiry).(*nonce)
+		delete(g.seen, n.key)
+	}
+}
+
+// expiryHeap is a min-heap of the nonces by their expiration.
+type expiryHeap []*nonce
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	n := x.(*nonce)
+	n.index = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return n
+}
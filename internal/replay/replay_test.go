@@ -0,0 +1,159 @@
+package replay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+)
+
+func stamped(id string, ts time.Time, nonce string) *metric.Metric {
+	m := metric.NewCounter(id, 1)
+	m.Timestamp = ts.UnixMilli()
+	m.Nonce = nonce
+	return m
+}
+
+func TestGuard_Accept(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		accepted []*metric.Metric
+		metric   *metric.Metric
+		wantErr  error
+	}{
+		{
+			name:   "fresh metric",
+			metric: stamped("PollCount", now, "n1"),
+		},
+		{
+			name:    "no stamp",
+			metric:  metric.NewCounter("PollCount", 1),
+			wantErr: ErrNoStamp,
+		},
+		{
+			name:    "too old",
+			metric:  stamped("PollCount", now.Add(-2*time.Minute), "n1"),
+			wantErr: ErrStale,
+		},
+		{
+			name:    "from the future",
+			metric:  stamped("PollCount", now.Add(2*time.Minute), "n1"),
+			wantErr: ErrStale,
+		},
+		{
+			name:     "replayed",
+			accepted: []*metric.Metric{stamped("PollCount", now, "n1")},
+			metric:   stamped("PollCount", now, "n1"),
+			wantErr:  ErrReplayed,
+		},
+		{
+			name:     "same nonce of another metric in the batch",
+			accepted: []*metric.Metric{stamped("PollCount", now, "n1")},
+			metric:   stamped("RandomValue", now, "n1"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(time.Minute, 10)
+			g.now = func() time.Time { return now }
+
+			for _, m := range tt.accepted {
+				_, err := g.Accept(m)
+				require.NoError(t, err)
+			}
+
+			_, err := g.Accept(tt.metric)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Zero(t, tt.metric.Timestamp)
+			assert.Empty(t, tt.metric.Nonce)
+		})
+	}
+}
+
+func TestGuard_Bounded(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	g := New(time.Minute, 2)
+	g.now = func() time.Time { return now }
+
+	for _, id := range []string{"a", "b"} {
+		_, err := g.Accept(stamped(id, now, "n1"))
+		require.NoError(t, err)
+	}
+
+	// The nonces are not forgotten early, so the full cache rejects the new metrics
+	_, err := g.Accept(stamped("c", now, "n1"))
+	require.ErrorIs(t, err, ErrFull)
+	_, err = g.Accept(stamped("a", now, "n1"))
+	require.ErrorIs(t, err, ErrReplayed)
+	assert.Len(t, g.seen, 2)
+
+	// The nonces leave the cache along with the window
+	g.now = func() time.Time { return now.Add(2 * time.Minute) }
+	_, err = g.Accept(stamped("d", now.Add(2*time.Minute), "n2"))
+	require.NoError(t, err)
+	assert.Len(t, g.seen, 1)
+}
+
+func TestGuard_SkewedClocks(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	g := New(time.Minute, 10)
+	g.now = func() time.Time { return now }
+
+	// The clock of the first client is ahead, so its nonce expires after the second one
+	_, err := g.Accept(stamped("a", now.Add(30*time.Second), "n1"))
+	require.NoError(t, err)
+	_, err = g.Accept(stamped("b", now.Add(-30*time.Second), "n1"))
+	require.NoError(t, err)
+
+	g.now = func() time.Time { return now.Add(40 * time.Second) }
+	_, err = g.Accept(stamped("c", now.Add(40*time.Second), "n1"))
+	require.NoError(t, err)
+	assert.Len(t, g.seen, 2)
+
+	// The nonce received first is still remembered
+	_, err = g.Accept(stamped("a", now.Add(30*time.Second), "n1"))
+	require.ErrorIs(t, err, ErrReplayed)
+}
+
+func TestGuard_AcceptBatch(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	g := New(time.Minute, 10)
+	g.now = func() time.Time { return now }
+
+	// A batch with a rejected metric is rejected as a whole
+	_, err := g.Accept(stamped("a", now, "n1"), stamped("b", now.Add(-2*time.Minute), "n1"))
+	require.ErrorIs(t, err, ErrStale)
+	assert.Empty(t, g.seen)
+
+	_, err = g.Accept(stamped("a", now, "n1"), stamped("a", now, "n1"))
+	require.ErrorIs(t, err, ErrReplayed)
+	assert.Empty(t, g.seen)
+
+	accepted, err := g.Accept(stamped("a", now, "n1"), stamped("b", now, "n1"))
+	require.NoError(t, err)
+	_, err = g.Accept(stamped("a", now, "n1"), stamped("b", now, "n1"))
+	require.ErrorIs(t, err, ErrReplayed)
+
+	// The batch is accepted again once forgotten, e.g. when it failed to be stored
+	accepted.Forget()
+	assert.Empty(t, g.seen)
+	assert.Empty(t, g.expiry)
+	_, err = g.Accept(stamped("a", now, "n1"), stamped("b", now, "n1"))
+	require.NoError(t, err)
+}
+
+func TestGuard_Nil(t *testing.T) {
+	var g *Guard
+	accepted, err := g.Accept(metric.NewCounter("PollCount", 1))
+	assert.NoError(t, err)
+	accepted.Forget()
+}
@@ -0,0 +1,83 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Policy describes how to retry transient failures.
+type Policy struct {
+	// MaxAttempts is the total amount of attempts including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay after the first failed attempt, it doubles after every next one.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// Jitter is a fraction of the delay (from 0 to 1) which is randomized.
+	Jitter float64
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks the error as transient, so the operation can be retried.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// IsRetryable reports whether the error is marked as transient.
+func IsRetryable(err error) bool {
+	var re *retryableError
+	return errors.As(err, &re)
+}
+
+// Do executes fn until it succeeds, returns a non-retryable error or the attempts are exhausted.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || !IsRetryable(err) {
+			return err
+		}
+		if attempt+1 >= p.MaxAttempts {
+			return errors.Wrapf(err, "gave up after %d attempts", attempt+1)
+		}
+
+		timer := time.NewTimer(p.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(err, ctx.Err().Error())
+		case <-timer.C:
+		}
+	}
+}
+
+// Delay returns the delay after the failed attempt with the given number, starting from 0.
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+
+	return delay
+}
@@ -0,0 +1,101 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Delay(t *testing.T) {
+	p := Policy{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+		Jitter:    0.5,
+	}
+
+	tests := []struct {
+		name    string
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{
+			name:    "first attempt",
+			attempt: 0,
+			min:     50 * time.Millisecond,
+			max:     100 * time.Millisecond,
+		},
+		{
+			name:    "third attempt",
+			attempt: 2,
+			min:     200 * time.Millisecond,
+			max:     400 * time.Millisecond,
+		},
+		{
+			name:    "capped",
+			attempt: 10,
+			min:     500 * time.Millisecond,
+			max:     time.Second,
+		},
+		{
+			name:    "overflow",
+			attempt: 100,
+			min:     500 * time.Millisecond,
+			max:     time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := p.Delay(tt.attempt)
+			assert.GreaterOrEqual(t, d, tt.min)
+			assert.LessOrEqual(t, d, tt.max)
+		})
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	p := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	transient := Retryable(errors.New("transient"))
+	permanent := errors.New("permanent")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "success after retries",
+			errs:         []error{transient, transient, nil},
+			wantErr:      false,
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts are exhausted",
+			errs:         []error{transient, transient, transient, nil},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "non-retryable error",
+			errs:         []error{permanent, nil},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := p.Do(context.Background(), func() error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
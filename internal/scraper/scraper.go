@@ -0,0 +1,165 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/delta"
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage"
+)
+
+// metricsPath is the path where agents expose their metrics in JSON.
+const metricsPath = "/metrics/json"
+
+// Scraper polls the agents running in the pull mode and stores their metrics.
+//
+// Agents expose cumulative counters, so only the increments since the previous
+// scrape of the same target are stored.
+type Scraper struct {
+	targets  []string
+	interval time.Duration
+	token    string
+	keys     *metric.Keyring
+	store    storage.Storage
+	client   *http.Client
+	trackers map[string]*delta.Tracker
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	logger zerolog.Logger
+}
+
+// New instantiates a new Scraper. Targets are the base addresses of the agents,
+// the token is sent to them as a bearer token if set. The interval should be positive.
+func New(
+	targets []string,
+	interval time.Duration,
+	token string,
+	keys *metric.Keyring,
+	store storage.Storage,
+	logService *loggerservice.LoggerService,
+) *Scraper {
+	trackers := make(map[string]*delta.Tracker, len(targets))
+	for _, target := range targets {
+		trackers[target] = delta.NewTracker(metric.Key{})
+	}
+
+	return &Scraper{
+		targets:  targets,
+		interval: interval,
+		token:    token,
+		keys:     keys,
+		store:    store,
+		client:   &http.Client{Timeout: interval},
+		trackers: trackers,
+		logger:   logService.ComponentLogger("Scraper"),
+	}
+}
+
+// Start starts polling the targets.
+func (s *Scraper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, target := range s.targets {
+		s.wg.Add(1)
+		go func(target string) {
+			defer s.wg.Done()
+			s.run(ctx, target)
+		}(target)
+	}
+}
+
+// Stop stops polling and waits for the running scrapes to finish.
+func (s *Scraper) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "scrapes did not finish in time")
+	}
+}
+
+func (s *Scraper) run(ctx context.Context, target string) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.scrape(ctx, target); err != nil {
+				s.logger.Error().Err(err).Msgf("failed to scrape %s", target)
+			}
+		}
+	}
+}
+
+func (s *Scraper) scrape(ctx context.Context, target string) error {
+	metrics, err := s.fetch(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return errors.Wrapf(err, "incorrect metric %v", m)
+		}
+		if err := m.VerifyHashWithKeyring(s.keys); err != nil {
+			return errors.Wrapf(err, "incorrect metric hash %v", m.Hash)
+		}
+	}
+
+	return s.trackers[target].Send(metrics, func(batch []*metric.Metric) error {
+		return s.store.UpdateAll(ctx, batch)
+	})
+}
+
+func (s *Scraper) fetch(ctx context.Context, target string) ([]*metric.Metric, error) {
+	url := strings.TrimSuffix(target, "/") + metricsPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a request")
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to file a request to URL: %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("not successfull status %d", resp.StatusCode)
+	}
+
+	var metrics []*metric.Metric
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return nil, errors.Wrap(err, "failed to decode metrics")
+	}
+
+	return metrics, nil
+}
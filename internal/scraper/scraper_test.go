@@ -0,0 +1,48 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	"github.com/denistakeda/alerting/internal/storage/memstorage"
+)
+
+func TestScraper_scrape(t *testing.T) {
+	var pollCount int64
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, metricsPath, r.URL.Path)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		pollCount += 5
+		require.NoError(t, json.NewEncoder(w).Encode([]*metric.Metric{
+			metric.NewCounter("PollCount", pollCount),
+			metric.NewGauge("Alloc", float64(pollCount)),
+		}))
+	}))
+	defer agent.Close()
+
+	logService := loggerservice.New()
+	store := memstorage.NewMemStorage("", logService)
+	s := New([]string{agent.URL}, time.Second, "secret", nil, store, logService)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.scrape(context.Background(), agent.URL))
+	}
+
+	// The cumulative counter should not be summed up on every scrape
+	m, ok := store.Get(context.Background(), metric.Counter, "PollCount")
+	require.True(t, ok)
+	assert.Equal(t, int64(15), *m.Delta)
+
+	m, ok = store.Get(context.Background(), metric.Gauge, "Alloc")
+	require.True(t, ok)
+	assert.Equal(t, float64(15), *m.Value)
+}
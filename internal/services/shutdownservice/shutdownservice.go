@@ -0,0 +1,116 @@
+package shutdownservice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+// Step is a named action executed during the shutdown.
+type Step struct {
+	Name string
+	Stop func(ctx context.Context) error
+}
+
+// ShutdownService coordinates the shutdown of the server components.
+//
+// Steps are grouped into stages. Stages are executed one after another,
+// steps inside of a stage are executed concurrently. The stages share the
+// same deadline, unless they have their own budget.
+type ShutdownService struct {
+	timeout time.Duration
+	stages  []stage
+	logger  zerolog.Logger
+}
+
+type stage struct {
+	steps []Step
+	// timeout is the own budget of the stage, the shared deadline is used if zero.
+	timeout time.Duration
+}
+
+// New instantiates a new ShutdownService.
+func New(timeout time.Duration, logService *loggerservice.LoggerService) *ShutdownService {
+	return &ShutdownService{
+		timeout: timeout,
+		logger:  logService.ComponentLogger("ShutdownService"),
+	}
+}
+
+// Stage adds a new stage of steps which are executed concurrently.
+func (s *ShutdownService) Stage(steps ...Step) {
+	s.stages = append(s.stages, stage{steps: steps})
+}
+
+// StageWithTimeout adds a new stage with its own budget, so it is given the
+// time even if the previous stages exceeded the shared deadline.
+func (s *ShutdownService) StageWithTimeout(timeout time.Duration, steps ...Step) {
+	s.stages = append(s.stages, stage{steps: steps, timeout: timeout})
+}
+
+// Shutdown executes all the stages and reports the steps which failed.
+func (s *ShutdownService) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	var failed []string
+	for _, st := range s.stages {
+		if st.timeout == 0 {
+			failed = append(failed, s.runStage(ctx, st.steps)...)
+			continue
+		}
+
+		stageCtx, stageCancel := context.WithTimeout(context.Background(), st.timeout)
+		failed = append(failed, s.runStage(stageCtx, st.steps)...)
+		stageCancel()
+	}
+
+	if ctx.Err() != nil {
+		s.logger.Warn().Msgf("shutdown deadline of %s was exceeded", s.timeout)
+	}
+
+	if len(failed) != 0 {
+		return errors.Errorf("shutdown finished with errors: %s", strings.Join(failed, "; "))
+	}
+
+	s.logger.Info().Msgf("shutdown finished in %s", time.Since(start))
+	return nil
+}
+
+func (s *ShutdownService) runStage(ctx context.Context, steps []Step) []string {
+	var (
+		wg     sync.WaitGroup
+		mx     sync.Mutex
+		failed []string
+	)
+
+	for _, step := range steps {
+		wg.Add(1)
+		go func(step Step) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := step.Stop(ctx)
+			if err != nil {
+				s.logger.Error().Err(err).Msgf("%s: failed to stop", step.Name)
+
+				mx.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %v", step.Name, err))
+				mx.Unlock()
+				return
+			}
+			s.logger.Info().Msgf("%s: stopped in %s", step.Name, time.Since(start))
+		}(step)
+	}
+	wg.Wait()
+
+	return failed
+}
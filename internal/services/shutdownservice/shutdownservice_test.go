@@ -0,0 +1,44 @@
+package shutdownservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+func TestShutdownService_StageWithTimeout(t *testing.T) {
+	s := New(20*time.Millisecond, loggerservice.New())
+
+	// The drain takes the whole shared deadline
+	s.Stage(Step{Name: "Server", Stop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}})
+
+	var flushErr error
+	s.StageWithTimeout(time.Second, Step{Name: "Storage", Stop: func(ctx context.Context) error {
+		flushErr = ctx.Err()
+		return nil
+	}})
+
+	assert.NoError(t, s.Shutdown())
+	assert.NoError(t, flushErr, "the stage with its own budget is not expired")
+}
+
+func TestShutdownService_SharedDeadline(t *testing.T) {
+	s := New(20*time.Millisecond, loggerservice.New())
+
+	s.Stage(Step{Name: "Server", Stop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}})
+	s.Stage(Step{Name: "Storage", Stop: func(ctx context.Context) error {
+		return ctx.Err()
+	}})
+
+	assert.Error(t, s.Shutdown())
+}
@@ -0,0 +1,320 @@
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/retry"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+// Policy defines what to do when the spool reaches its size limit.
+type Policy string
+
+const (
+	// DropOldest removes the oldest batches to free space for a new one.
+	DropOldest Policy = "drop_oldest"
+	// DropNewest rejects the new batch.
+	DropNewest Policy = "drop_newest"
+)
+
+const (
+	fileExt = ".json"
+	// tempExt is the extension of the batches being written, they are renamed
+	// once complete, so a crash does not leave a truncated batch.
+	tempExt = ".tmp"
+)
+
+var backoffPolicy = retry.Policy{
+	BaseDelay: time.Second,
+	MaxDelay:  time.Minute,
+	Jitter:    0.2,
+}
+
+var (
+	// ErrNotReady is returned by Replay when the backoff after the previous failure is not elapsed yet.
+	ErrNotReady = errors.New("spool is waiting for backoff")
+	// ErrFull is returned by Push when the batch does not fit into the spool.
+	ErrFull = errors.New("spool is full")
+)
+
+type batch struct {
+	seq  uint64
+	size int64
+}
+
+// Spool is a persistent on-disk queue of metric batches which failed to be sent.
+type Spool struct {
+	dir     string
+	maxSize int64
+	policy  Policy
+
+	// replayMx serializes the replays, the batches are sent without holding mx
+	replayMx    sync.Mutex
+	mx          sync.Mutex
+	batches     []batch
+	size        int64
+	nextSeq     uint64
+	failures    int
+	nextAttempt time.Time
+
+	logger zerolog.Logger
+}
+
+// New instantiates a new Spool restoring the batches left in the directory.
+// A zero maxSize means the size of the spool is unlimited.
+func New(dir string, maxSize int64, policy Policy, logService *loggerservice.LoggerService) (*Spool, error) {
+	if policy != DropOldest && policy != DropNewest {
+		return nil, errors.Errorf("unknown spool policy '%s'", policy)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create spool directory %s", dir)
+	}
+
+	s := &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		policy:  policy,
+		nextSeq: 1,
+		logger:  logService.ComponentLogger("Spool"),
+	}
+
+	if err := s.restore(); err != nil {
+		return nil, errors.Wrap(err, "failed to restore spool")
+	}
+
+	return s, nil
+}
+
+// Len returns the amount of batches in the spool.
+func (s *Spool) Len() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return len(s.batches)
+}
+
+// Push stores the batch at the end of the queue.
+func (s *Spool) Push(metrics []*metric.Metric) error {
+	content, err := json.Marshal(metrics)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal metrics")
+	}
+	size := int64(len(content))
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.maxSize > 0 {
+		if size > s.maxSize {
+			return errors.Wrapf(ErrFull, "batch of %d bytes exceeds the spool limit", size)
+		}
+
+		for s.size+size > s.maxSize {
+			if s.policy == DropNewest {
+				return errors.Wrapf(ErrFull, "%d bytes of %d are used", s.size, s.maxSize)
+			}
+			if err := s.removeFirst(); err != nil {
+				return err
+			}
+			s.logger.Warn().Msg("spool is full, the oldest batch was dropped")
+		}
+	}
+
+	b := batch{seq: s.nextSeq, size: size}
+	if err := writeFile(s.path(b.seq), content); err != nil {
+		return errors.Wrap(err, "failed to write batch to the spool")
+	}
+
+	s.nextSeq++
+	s.batches = append(s.batches, b)
+	s.size += size
+
+	return nil
+}
+
+// Replay sends the stored batches in order, removing each one after it is sent.
+// It stops on the first failure and postpones the next attempt with an exponential backoff.
+// The new batches can be pushed while the stored ones are sent.
+func (s *Spool) Replay(send func([]*metric.Metric) error) error {
+	s.replayMx.Lock()
+	defer s.replayMx.Unlock()
+
+	s.mx.Lock()
+	if len(s.batches) == 0 {
+		s.mx.Unlock()
+		return nil
+	}
+	if time.Now().Before(s.nextAttempt) {
+		s.mx.Unlock()
+		return ErrNotReady
+	}
+	batches := append([]batch(nil), s.batches...)
+	s.mx.Unlock()
+
+	for _, b := range batches {
+		metrics, err := s.read(b.seq)
+		if err != nil {
+			// The batch may be dropped by Push meanwhile
+			if !errors.Is(err, os.ErrNotExist) {
+				s.logger.Error().Err(err).Msg("failed to read a batch, dropping it")
+			}
+			if err := s.remove(b.seq); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := send(metrics); err != nil {
+			s.mx.Lock()
+			s.backoff()
+			s.mx.Unlock()
+			return errors.Wrap(err, "failed to replay spooled batch")
+		}
+
+		if err := s.remove(b.seq); err != nil {
+			return err
+		}
+	}
+
+	s.mx.Lock()
+	s.failures = 0
+	s.nextAttempt = time.Time{}
+	s.mx.Unlock()
+
+	return nil
+}
+
+func (s *Spool) backoff() {
+	s.nextAttempt = time.Now().Add(backoffPolicy.Delay(s.failures))
+	s.failures++
+}
+
+func (s *Spool) read(seq uint64) ([]*metric.Metric, error) {
+	content, err := os.ReadFile(s.path(seq))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read batch")
+	}
+
+	var metrics []*metric.Metric
+	if err := json.Unmarshal(content, &metrics); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal batch")
+	}
+
+	return metrics, nil
+}
+
+// remove removes the batch if it is still in the spool.
+func (s *Spool) remove(seq uint64) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for i, b := range s.batches {
+		if b.seq != seq {
+			continue
+		}
+		if err := os.Remove(s.path(seq)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove batch from the spool")
+		}
+		s.batches = append(s.batches[:i], s.batches[i+1:]...)
+		s.size -= b.size
+		return nil
+	}
+	return nil
+}
+
+func (s *Spool) removeFirst() error {
+	b := s.batches[0]
+	if err := os.Remove(s.path(b.seq)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove batch from the spool")
+	}
+
+	s.batches = s.batches[1:]
+	s.size -= b.size
+
+	return nil
+}
+
+func (s *Spool) restore() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read directory %s", s.dir)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, tempExt) {
+			// The batch was not written completely
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return errors.Wrapf(err, "failed to remove incomplete batch %s", name)
+			}
+			continue
+		}
+		if entry.IsDir() || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, fileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return errors.Wrapf(err, "failed to stat file %s", name)
+		}
+
+		s.batches = append(s.batches, batch{seq: seq, size: info.Size()})
+		s.size += info.Size()
+	}
+
+	sort.Slice(s.batches, func(i, j int) bool {
+		return s.batches[i].seq < s.batches[j].seq
+	})
+	if len(s.batches) > 0 {
+		s.nextSeq = s.batches[len(s.batches)-1].seq + 1
+		s.logger.Info().Msgf("restored %d batches from the spool", len(s.batches))
+	}
+
+	return nil
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, fileExt))
+}
+
+// writeFile writes the content to a temporary file and renames it, so the file
+// is either complete or missing after a crash.
+func writeFile(path string, content []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "*"+tempExt)
+	if err != nil {
+		return errors.Wrap(err, "failed to create a temporary file")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write a temporary file")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to sync a temporary file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close a temporary file")
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), path), "failed to rename a temporary file")
+}
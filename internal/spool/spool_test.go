@@ -0,0 +1,133 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+func TestSpool_ReplayInOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, 0, DropOldest, loggerservice.New())
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push([]*metric.Metric{metric.NewCounter("c", 1)}))
+	require.NoError(t, s.Push([]*metric.Metric{metric.NewCounter("c", 2)}))
+
+	// The batches should survive the restart
+	s, err = New(dir, 0, DropOldest, loggerservice.New())
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Len())
+
+	var sent []int64
+	err = s.Replay(func(ms []*metric.Metric) error {
+		sent = append(sent, *ms[0].Delta)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, sent)
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestSpool_ReplayFailure(t *testing.T) {
+	s, err := New(t.TempDir(), 0, DropOldest, loggerservice.New())
+	require.NoError(t, err)
+	require.NoError(t, s.Push([]*metric.Metric{metric.NewGauge("g", 1)}))
+
+	err = s.Replay(func([]*metric.Metric) error {
+		return errors.New("server is down")
+	})
+	require.Error(t, err)
+	assert.Equal(t, 1, s.Len())
+
+	err = s.Replay(func([]*metric.Metric) error { return nil })
+	assert.ErrorIs(t, err, ErrNotReady)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestSpool_Policies(t *testing.T) {
+	batch := []*metric.Metric{metric.NewGauge("g", 1)}
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr error
+		wantLen int
+	}{
+		{
+			name:    "drop oldest",
+			policy:  DropOldest,
+			wantErr: nil,
+			wantLen: 1,
+		},
+		{
+			name:    "drop newest",
+			policy:  DropNewest,
+			wantErr: ErrFull,
+			wantLen: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Enough space for exactly one batch
+			s, err := New(t.TempDir(), batchSize(t, batch), tt.policy, loggerservice.New())
+			require.NoError(t, err)
+
+			require.NoError(t, s.Push(batch))
+			err = s.Push(batch)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantLen, s.Len())
+		})
+	}
+}
+
+func TestSpool_PushWhileReplaying(t *testing.T) {
+	s, err := New(t.TempDir(), 0, DropOldest, loggerservice.New())
+	require.NoError(t, err)
+	require.NoError(t, s.Push([]*metric.Metric{metric.NewCounter("c", 1)}))
+
+	// The batch failed to be sent is pushed while the spool is replayed
+	var sent []int64
+	err = s.Replay(func(ms []*metric.Metric) error {
+		sent = append(sent, *ms[0].Delta)
+		return s.Push([]*metric.Metric{metric.NewCounter("c", 2)})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, sent)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestSpool_RestoreIncomplete(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, 0, DropOldest, loggerservice.New())
+	require.NoError(t, err)
+	require.NoError(t, s.Push([]*metric.Metric{metric.NewCounter("c", 1)}))
+
+	// A crash while writing leaves a temporary file
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "123"+tempExt), []byte(`[{"id":"c"`), 0600))
+
+	s, err = New(dir, 0, DropOldest, loggerservice.New())
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Len())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// batchSize returns the size of the batch stored in the spool.
+func batchSize(t *testing.T, batch []*metric.Metric) int64 {
+	s, err := New(t.TempDir(), 0, DropOldest, loggerservice.New())
+	require.NoError(t, err)
+	require.NoError(t, s.Push(batch))
+	return s.size
+}
@@ -0,0 +1,67 @@
+package dbstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/audit"
+)
+
+// AppendAudit adds an entry and assigns its ID.
+func (dbs *DBStorage) AppendAudit(ctx context.Context, entry *audit.Entry) error {
+	rows, err := dbs.db.NamedQueryContext(ctx, `
+		INSERT INTO audit (time, actor, ip, action, target, outcome, details)
+		VALUES (:time, :actor, :ip, :action, :target, :outcome, :details)
+		RETURNING id
+	`, entry)
+	if err != nil {
+		return errors.Wrap(err, "unable to append audit entry")
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err := rows.Scan(&entry.ID); err != nil {
+			return errors.Wrap(err, "unable to read audit entry ID")
+		}
+	}
+	return errors.Wrap(rows.Err(), "unable to append audit entry")
+}
+
+// AuditEntries returns the newest entries selected by the filter.
+func (dbs *DBStorage) AuditEntries(ctx context.Context, filter audit.Filter) ([]*audit.Entry, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Actor != "" {
+		where("actor = $%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		where("time >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("time < $%d", filter.Until)
+	}
+
+	query := `SELECT id, time, actor, ip, action, target, outcome, details FROM audit`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Size())
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	result := make([]*audit.Entry, 0)
+	if err := dbs.db.SelectContext(ctx, &result, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to query audit entries")
+	}
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package dbstorage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/auth"
+)
+
+// SaveToken stores a new token.
+func (dbs *DBStorage) SaveToken(ctx context.Context, token *auth.Token) error {
+	_, err := dbs.db.NamedExecContext(ctx, `
+		INSERT INTO tokens (id, name, hash, scopes, created_at)
+		VALUES (:id, :name, :hash, :scopes, :created_at)
+	`, token)
+	if err != nil {
+		return errors.Wrap(err, "unable to save token")
+	}
+	return nil
+}
+
+// TokenByHash returns a token by the hash of its secret.
+func (dbs *DBStorage) TokenByHash(ctx context.Context, hash string) (*auth.Token, bool) {
+	var token auth.Token
+	err := dbs.db.GetContext(ctx, &token, `
+		SELECT id, name, hash, scopes, created_at
+		FROM tokens
+		WHERE hash = $1
+	`, hash)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			dbs.logger.Error().Err(err).Msg("failed to query token")
+		}
+		return nil, false
+	}
+	return &token, true
+}
+
+// Tokens returns all the tokens ordered by creation time.
+func (dbs *DBStorage) Tokens(ctx context.Context) ([]*auth.Token, error) {
+	result := make([]*auth.Token, 0)
+	err := dbs.db.SelectContext(ctx, &result, `
+		SELECT id, name, hash, scopes, created_at
+		FROM tokens
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query list of tokens")
+	}
+	return result, nil
+}
+
+// RevokeToken deletes a token, auth.ErrTokenNotFound is returned if it does not exist.
+func (dbs *DBStorage) RevokeToken(ctx context.Context, id string) error {
+	res, err := dbs.db.ExecContext(ctx, `DELETE FROM tokens WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "unable to revoke token")
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "unable to revoke token")
+	}
+	if deleted == 0 {
+		return auth.ErrTokenNotFound
+	}
+	return nil
+}
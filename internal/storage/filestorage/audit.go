@@ -0,0 +1,111 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/audit"
+)
+
+// AppendAudit adds an entry and assigns its ID.
+func (fs *Filestorage) AppendAudit(_ context.Context, entry *audit.Entry) error {
+	fs.auditMx.Lock()
+	defer fs.auditMx.Unlock()
+
+	file, err := os.OpenFile(fs.auditFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open audit file %s", fs.auditFile())
+	}
+	entry.ID = fs.auditSeq + 1
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		_ = file.Close()
+		return errors.Wrapf(err, "failed to write to audit file %s", fs.auditFile())
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close audit file %s", fs.auditFile())
+	}
+	fs.auditSeq = entry.ID
+	return nil
+}
+
+// AuditEntries returns the newest entries selected by the filter. The entries
+// are read from the file, only the selected ones are kept in memory.
+func (fs *Filestorage) AuditEntries(_ context.Context, filter audit.Filter) ([]*audit.Entry, error) {
+	fs.auditMx.Lock()
+	defer fs.auditMx.Unlock()
+
+	// The newest entries are at the end of the file, so the last selected ones are kept in a ring
+	size := filter.Size()
+	ring := make([]*audit.Entry, 0, size)
+	next := 0
+	err := fs.scanAudit(func(entry *audit.Entry) {
+		if !filter.Match(entry) {
+			return
+		}
+		if len(ring) < size {
+			ring = append(ring, entry)
+			return
+		}
+		ring[next] = entry
+		next = (next + 1) % size
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*audit.Entry, 0, len(ring))
+	for i := len(ring) - 1; i >= 0; i-- {
+		res = append(res, ring[(next+i)%len(ring)])
+	}
+	return res, nil
+}
+
+// auditFile keeps the audit log apart from the metrics, the entries are only appended to it.
+func (fs *Filestorage) auditFile() string {
+	return fs.storeFile + ".audit"
+}
+
+// restoreAudit continues the IDs of the entries in the file.
+func (fs *Filestorage) restoreAudit() error {
+	fs.auditMx.Lock()
+	defer fs.auditMx.Unlock()
+
+	return fs.scanAudit(func(entry *audit.Entry) {
+		if entry.ID > fs.auditSeq {
+			fs.auditSeq = entry.ID
+		}
+	})
+}
+
+// scanAudit reads the entries of the file in order, a missing file has no entries.
+func (fs *Filestorage) scanAudit(fn func(entry *audit.Entry)) error {
+	file, err := os.Open(fs.auditFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read audit file %s", fs.auditFile())
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fs.logger.Error().Err(err).Msgf("failed to close file \"%s\"", fs.auditFile())
+		}
+	}()
+
+	decoder := json.NewDecoder(file)
+	for {
+		var entry audit.Entry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse audit file %s", fs.auditFile())
+		}
+		fn(&entry)
+	}
+}
@@ -0,0 +1,52 @@
+package filestorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+)
+
+func TestFilestorage_Audit(t *testing.T) {
+	ctx := context.Background()
+	storeFile := filepath.Join(t.TempDir(), "metrics.json")
+	newStorage := func() *Filestorage {
+		fs, err := NewFileStorage(ctx, storeFile, 0, false, "", loggerservice.New())
+		require.NoError(t, err)
+		return fs
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs := newStorage()
+	for i, action := range []string{"token.create", "token.revoke", "token.create"} {
+		require.NoError(t, fs.AppendAudit(ctx, &audit.Entry{
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			Actor:  "admin",
+			Action: action,
+		}))
+	}
+
+	// The IDs continue after a restart
+	fs = newStorage()
+	require.NoError(t, fs.AppendAudit(ctx, &audit.Entry{
+		Time:   start.Add(3 * time.Minute),
+		Actor:  "admin",
+		Action: "token.create",
+	}))
+
+	entries, err := fs.AuditEntries(ctx, audit.Filter{Action: "token.create"})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, []int64{4, 3, 1}, []int64{entries[0].ID, entries[1].ID, entries[2].ID}, "the newest entries go first")
+
+	entries, err = fs.AuditEntries(ctx, audit.Filter{Since: start.Add(time.Minute), Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, []int64{4, 3}, []int64{entries[0].ID, entries[1].ID})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -22,6 +23,10 @@ type Filestorage struct {
 	storeFile   string
 	storeTicker *time.Ticker
 
+	// auditMx keeps the entries in the file in the order of their IDs
+	auditMx  sync.Mutex
+	auditSeq int64
+
 	logger zerolog.Logger
 }
 
@@ -40,6 +45,14 @@ func NewFileStorage(
 		logger:    logService.ComponentLogger("Filestorage"),
 	}
 
+	// Tokens and the audit log are always restored, unlike the metrics they are not reported again
+	if err := instance.restoreTokens(ctx); err != nil {
+		return nil, errors.Wrap(err, "unable to initiate a Filestorage")
+	}
+	if err := instance.restoreAudit(); err != nil {
+		return nil, errors.Wrap(err, "unable to initiate a Filestorage")
+	}
+
 	if restore {
 		if err := instance.restore(ctx); err != nil {
 			return nil, errors.Wrap(err, "unable to initiate a Filestorage")
@@ -91,7 +104,9 @@ func (fs *Filestorage) All(ctx context.Context) []*metric.Metric {
 
 // Close closes the connection to db.
 func (fs *Filestorage) Close(ctx context.Context) error {
-	fs.storeTicker.Stop()
+	if fs.storeTicker != nil {
+		fs.storeTicker.Stop()
+	}
 	fs.dump(ctx)
 	return fs.mstorage.Close(ctx)
 }
@@ -0,0 +1,85 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/auth"
+)
+
+// SaveToken stores a new token.
+func (fs *Filestorage) SaveToken(ctx context.Context, token *auth.Token) error {
+	if err := fs.mstorage.SaveToken(ctx, token); err != nil {
+		return err
+	}
+	return fs.dumpTokens(ctx)
+}
+
+// TokenByHash returns a token by the hash of its secret.
+func (fs *Filestorage) TokenByHash(ctx context.Context, hash string) (*auth.Token, bool) {
+	return fs.mstorage.TokenByHash(ctx, hash)
+}
+
+// Tokens returns all the tokens.
+func (fs *Filestorage) Tokens(ctx context.Context) ([]*auth.Token, error) {
+	return fs.mstorage.Tokens(ctx)
+}
+
+// RevokeToken deletes a token, auth.ErrTokenNotFound is returned if it does not exist.
+func (fs *Filestorage) RevokeToken(ctx context.Context, id string) error {
+	if err := fs.mstorage.RevokeToken(ctx, id); err != nil {
+		return err
+	}
+	return fs.dumpTokens(ctx)
+}
+
+// tokensFile keeps the tokens apart from the metrics, they are written on every change.
+func (fs *Filestorage) tokensFile() string {
+	return fs.storeFile + ".tokens"
+}
+
+func (fs *Filestorage) dumpTokens(ctx context.Context) error {
+	tokens, err := fs.mstorage.Tokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(tokens)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal tokens")
+	}
+
+	// Write to a temporary file first, so a crash never leaves a truncated file
+	tmp := fs.tokensFile() + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write tokens to file %s", tmp)
+	}
+	if err := os.Rename(tmp, fs.tokensFile()); err != nil {
+		return errors.Wrapf(err, "failed to replace tokens file %s", fs.tokensFile())
+	}
+	return nil
+}
+
+func (fs *Filestorage) restoreTokens(ctx context.Context) error {
+	content, err := os.ReadFile(fs.tokensFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read tokens from file %s", fs.tokensFile())
+	}
+
+	var tokens []*auth.Token
+	if err := json.Unmarshal(content, &tokens); err != nil {
+		return errors.Wrapf(err, "failed to parse tokens file %s", fs.tokensFile())
+	}
+	for _, token := range tokens {
+		if err := fs.mstorage.SaveToken(ctx, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package limitstorage limits the number of distinct series of a storage.
+package limitstorage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	s "github.com/denistakeda/alerting/internal/storage"
+)
+
+// Limits are the numbers of distinct series, zero is unlimited.
+type Limits struct {
+	// Max is the number of all the series.
+	Max int
+	// Prefixes maps the name prefixes to the number of series with that prefix.
+	// A series is counted against every prefix it matches.
+	Prefixes map[string]int
+}
+
+// Cardinality is the current number of series.
+type Cardinality struct {
+	Series   int                 `json:"series"`
+	Limit    int                 `json:"limit"`
+	Rejected int64               `json:"rejected"`
+	Prefixes []PrefixCardinality `json:"prefixes"`
+}
+
+// PrefixCardinality is the number of series with a prefix.
+type PrefixCardinality struct {
+	Prefix string `json:"prefix"`
+	Series int    `json:"series"`
+	Limit  int    `json:"limit"`
+}
+
+// Limitstorage is a Storage rejecting new series beyond the limits.
+// The updates of the existing series are always accepted.
+type Limitstorage struct {
+	store  s.Storage
+	limits Limits
+
+	mx       sync.Mutex
+	series   map[string]struct{}
+	prefixes map[string]int
+
+	rejected atomic.Int64
+
+	logger zerolog.Logger
+}
+
+// NewLimitStorage wraps the storage, the series already stored are counted.
+func NewLimitStorage(
+	ctx context.Context,
+	store s.Storage,
+	limits Limits,
+	logService *loggerservice.LoggerService,
+) *Limitstorage {
+	instance := &Limitstorage{
+		store:    store,
+		limits:   limits,
+		series:   make(map[string]struct{}),
+		prefixes: make(map[string]int, len(limits.Prefixes)),
+		logger:   logService.ComponentLogger("Limitstorage"),
+	}
+
+	for _, m := range store.All(ctx) {
+		instance.add(seriesKey(m.Type(), m.Name()), m.Name())
+	}
+
+	return instance
+}
+
+// Get returns a metric if exists.
+func (ls *Limitstorage) Get(ctx context.Context, metricType metric.Type, metricName string) (*metric.Metric, bool) {
+	return ls.store.Get(ctx, metricType, metricName)
+}
+
+// Update updates a metric, a new series beyond the limits is rejected with s.ErrSeriesLimit.
+func (ls *Limitstorage) Update(ctx context.Context, updatedMetric *metric.Metric) (*metric.Metric, error) {
+	allowed, added, rejected := ls.admit([]*metric.Metric{updatedMetric})
+	if len(allowed) == 0 {
+		return nil, &s.SeriesLimitError{Rejected: rejected}
+	}
+
+	res, err := ls.store.Update(ctx, updatedMetric)
+	if err != nil {
+		ls.forget(added)
+	}
+	return res, err
+}
+
+// UpdateAll updates all the metrics in list. The new series beyond the limits
+// are skipped and listed in s.SeriesLimitError, the rest is stored.
+func (ls *Limitstorage) UpdateAll(ctx context.Context, metrics []*metric.Metric) error {
+	allowed, added, rejected := ls.admit(metrics)
+	if len(allowed) > 0 {
+		if err := ls.store.UpdateAll(ctx, allowed); err != nil {
+			ls.forget(added)
+			return err
+		}
+	}
+
+	if len(rejected) > 0 {
+		return &s.SeriesLimitError{Rejected: rejected}
+	}
+	return nil
+}
+
+// All returns all the metrics.
+func (ls *Limitstorage) All(ctx context.Context) []*metric.Metric {
+	return ls.store.All(ctx)
+}
+
+// Close closes the wrapped storage.
+func (ls *Limitstorage) Close(ctx context.Context) error {
+	return ls.store.Close(ctx)
+}
+
+// Ping pings the wrapped storage.
+func (ls *Limitstorage) Ping(ctx context.Context) error {
+	return ls.store.Ping(ctx)
+}
+
+// Cardinality returns the current number of series and the limits.
+func (ls *Limitstorage) Cardinality() Cardinality {
+	ls.mx.Lock()
+	defer ls.mx.Unlock()
+
+	prefixes := make([]PrefixCardinality, 0, len(ls.limits.Prefixes))
+	for prefix, limit := range ls.limits.Prefixes {
+		prefixes = append(prefixes, PrefixCardinality{
+			Prefix: prefix,
+			Series: ls.prefixes[prefix],
+			Limit:  limit,
+		})
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].Prefix < prefixes[j].Prefix })
+
+	return Cardinality{
+		Series:   len(ls.series),
+		Limit:    ls.limits.Max,
+		Rejected: ls.rejected.Load(),
+		Prefixes: prefixes,
+	}
+}
+
+// admit splits the metrics into the allowed and rejected ones. The new series
+// are counted right away, so the concurrent updates do not exceed the limits.
+func (ls *Limitstorage) admit(metrics []*metric.Metric) (allowed []*metric.Metric, added []string, rejected []s.Series) {
+	ls.mx.Lock()
+	defer ls.mx.Unlock()
+
+	allowed = make([]*metric.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		key := seriesKey(m.Type(), m.Name())
+		if _, ok := ls.series[key]; ok {
+			allowed = append(allowed, m)
+			continue
+		}
+
+		if !ls.fits(m.Name()) {
+			rejected = append(rejected, s.Series{Type: m.Type(), ID: m.ID})
+			continue
+		}
+		ls.add(key, m.Name())
+		added = append(added, key)
+		allowed = append(allowed, m)
+	}
+
+	if len(rejected) > 0 {
+		ls.rejected.Add(int64(len(rejected)))
+		ls.logger.Warn().Msgf("rejected %d new series beyond the limits", len(rejected))
+	}
+	return allowed, added, rejected
+}
+
+func (ls *Limitstorage) fits(name string) bool {
+	if ls.limits.Max > 0 && len(ls.series) >= ls.limits.Max {
+		return false
+	}
+	for prefix, limit := range ls.limits.Prefixes {
+		if limit > 0 && strings.HasPrefix(name, prefix) && ls.prefixes[prefix] >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+func (ls *Limitstorage) add(key, name string) {
+	ls.series[key] = struct{}{}
+	for prefix := range ls.limits.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			ls.prefixes[prefix]++
+		}
+	}
+}
+
+// forget removes the series which failed to be stored.
+func (ls *Limitstorage) forget(keys []string) {
+	ls.mx.Lock()
+	defer ls.mx.Unlock()
+
+	for _, key := range keys {
+		delete(ls.series, key)
+		_, name, _ := strings.Cut(key, ":")
+		for prefix := range ls.limits.Prefixes {
+			if strings.HasPrefix(name, prefix) {
+				ls.prefixes[prefix]--
+			}
+		}
+	}
+}
+
+func seriesKey(metricType metric.Type, name string) string {
+	return string(metricType) + ":" + name
+}
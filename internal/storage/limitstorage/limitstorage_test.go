@@ -0,0 +1,90 @@
+package limitstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denistakeda/alerting/internal/metric"
+	"github.com/denistakeda/alerting/internal/services/loggerservice"
+	s "github.com/denistakeda/alerting/internal/storage"
+	"github.com/denistakeda/alerting/internal/storage/memstorage"
+)
+
+func newTestStorage(t *testing.T, limits Limits, existing ...*metric.Metric) *Limitstorage {
+	logService := loggerservice.New()
+	store := memstorage.NewMemStorage("", logService)
+	require.NoError(t, store.UpdateAll(context.Background(), existing))
+	return NewLimitStorage(context.Background(), store, limits, logService)
+}
+
+func TestLimitstorage_Update(t *testing.T) {
+	ctx := context.Background()
+	ls := newTestStorage(t, Limits{Max: 2}, metric.NewGauge("Alloc", 1))
+
+	_, err := ls.Update(ctx, metric.NewCounter("PollCount", 1))
+	require.NoError(t, err)
+
+	_, err = ls.Update(ctx, metric.NewGauge("request_42", 1))
+	assert.ErrorIs(t, err, s.ErrSeriesLimit)
+	_, ok := ls.Get(ctx, metric.Gauge, "request_42")
+	assert.False(t, ok)
+
+	// The existing series are updated at the limit
+	_, err = ls.Update(ctx, metric.NewGauge("Alloc", 2))
+	require.NoError(t, err)
+	res, ok := ls.Get(ctx, metric.Gauge, "Alloc")
+	require.True(t, ok)
+	assert.Equal(t, float64(2), *res.Value)
+
+	// A gauge and a counter with the same name are different series
+	_, err = ls.Update(ctx, metric.NewCounter("Alloc", 1))
+	assert.ErrorIs(t, err, s.ErrSeriesLimit)
+}
+
+func TestLimitstorage_UpdateAll(t *testing.T) {
+	ctx := context.Background()
+	ls := newTestStorage(t, Limits{
+		Max:      10,
+		Prefixes: map[string]int{"request_": 1},
+	}, metric.NewCounter("PollCount", 1))
+
+	err := ls.UpdateAll(ctx, []*metric.Metric{
+		metric.NewCounter("PollCount", 2),
+		metric.NewGauge("request_1", 1),
+		metric.NewGauge("request_2", 1),
+		metric.NewGauge("Alloc", 1),
+	})
+
+	var limitErr *s.SeriesLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, []s.Series{{Type: metric.Gauge, ID: "request_2"}}, limitErr.Rejected)
+
+	res, ok := ls.Get(ctx, metric.Counter, "PollCount")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), *res.Delta)
+	_, ok = ls.Get(ctx, metric.Gauge, "Alloc")
+	assert.True(t, ok)
+	_, ok = ls.Get(ctx, metric.Gauge, "request_2")
+	assert.False(t, ok)
+
+	assert.Equal(t, Cardinality{
+		Series:   3,
+		Limit:    10,
+		Rejected: 1,
+		Prefixes: []PrefixCardinality{{Prefix: "request_", Series: 1, Limit: 1}},
+	}, ls.Cardinality())
+}
+
+func TestLimitstorage_Unlimited(t *testing.T) {
+	ctx := context.Background()
+	ls := newTestStorage(t, Limits{})
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := ls.Update(ctx, metric.NewGauge(name, 1))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, ls.Cardinality().Series)
+}
@@ -0,0 +1,39 @@
+package memstorage
+
+import (
+	"context"
+
+	"github.com/denistakeda/alerting/internal/audit"
+)
+
+// maxAuditEntries is the number of the newest entries kept in memory, the older ones are dropped.
+const maxAuditEntries = 10000
+
+// AppendAudit adds an entry and assigns its ID.
+func (m *Memstorage) AppendAudit(_ context.Context, entry *audit.Entry) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.auditSeq++
+	entry.ID = m.auditSeq
+	if len(m.audit) >= maxAuditEntries {
+		m.audit[0] = nil
+		m.audit = m.audit[1:]
+	}
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+// AuditEntries returns the newest entries selected by the filter.
+func (m *Memstorage) AuditEntries(_ context.Context, filter audit.Filter) ([]*audit.Entry, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	res := make([]*audit.Entry, 0)
+	for i := len(m.audit) - 1; i >= 0 && len(res) < filter.Size(); i-- {
+		if filter.Match(m.audit[i]) {
+			res = append(res, m.audit[i])
+		}
+	}
+	return res, nil
+}
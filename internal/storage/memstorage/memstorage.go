@@ -7,6 +7,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
 	"github.com/denistakeda/alerting/internal/metric"
 	"github.com/denistakeda/alerting/internal/services/loggerservice"
 )
@@ -15,6 +17,9 @@ import (
 type Memstorage struct {
 	gauges   map[string]*metric.Metric
 	counters map[string]*metric.Metric
+	tokens   map[string]*auth.Token
+	audit    []*audit.Entry
+	auditSeq int64
 	hashKey  string
 	mx       sync.Mutex
 	logger   zerolog.Logger
@@ -25,6 +30,7 @@ func NewMemStorage(hashKey string, logService *loggerservice.LoggerService) *Mem
 	return &Memstorage{
 		gauges:   make(map[string]*metric.Metric),
 		counters: make(map[string]*metric.Metric),
+		tokens:   make(map[string]*auth.Token),
 		hashKey:  hashKey,
 		logger:   logService.ComponentLogger("Memstorage"),
 	}
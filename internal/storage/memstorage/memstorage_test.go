@@ -3,18 +3,83 @@ package memstorage
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/denistakeda/alerting/internal/services/loggerservice"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
 	"github.com/denistakeda/alerting/internal/metric"
 	"github.com/denistakeda/alerting/internal/storage"
 )
 
 func Test_memstorage_ImplementsStorage(t *testing.T) {
 	var _ storage.Storage = (*Memstorage)(nil)
+	var _ storage.TokenStorage = (*Memstorage)(nil)
+	var _ storage.AuditStorage = (*Memstorage)(nil)
+}
+
+func Test_memstorage_Audit(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemStorage("", loggerservice.New())
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, action := range []string{"token.create", "token.revoke", "token.create"} {
+		require.NoError(t, m.AppendAudit(ctx, &audit.Entry{
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			Actor:  "admin",
+			Action: action,
+		}))
+	}
+
+	entries, err := m.AuditEntries(ctx, audit.Filter{Action: "token.create"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(3), entries[0].ID, "the newest entries go first")
+	assert.Equal(t, int64(1), entries[1].ID)
+
+	entries, err = m.AuditEntries(ctx, audit.Filter{Since: start.Add(time.Minute), Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(3), entries[0].ID)
+}
+
+func Test_memstorage_AuditBounded(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemStorage("", loggerservice.New())
+
+	for i := 0; i < maxAuditEntries+5; i++ {
+		require.NoError(t, m.AppendAudit(ctx, &audit.Entry{Action: "token.create"}))
+	}
+
+	assert.Len(t, m.audit, maxAuditEntries)
+	assert.Equal(t, int64(6), m.audit[0].ID, "the oldest entries are dropped")
+	assert.Equal(t, int64(maxAuditEntries+5), m.audit[maxAuditEntries-1].ID)
+}
+
+func Test_memstorage_Tokens(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemStorage("", loggerservice.New())
+
+	token, secret, err := auth.NewToken("agent", auth.Scopes{auth.ScopeWrite})
+	require.NoError(t, err)
+	require.NoError(t, m.SaveToken(ctx, token))
+
+	found, ok := m.TokenByHash(ctx, auth.Hash(secret))
+	require.True(t, ok)
+	assert.Equal(t, token, found)
+
+	tokens, err := m.Tokens(ctx)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+
+	require.NoError(t, m.RevokeToken(ctx, token.ID))
+	_, ok = m.TokenByHash(ctx, auth.Hash(secret))
+	assert.False(t, ok)
+	assert.ErrorIs(t, m.RevokeToken(ctx, token.ID), auth.ErrTokenNotFound)
 }
 
 func Test_memstorage_Get(t *testing.T) {
@@ -0,0 +1,56 @@
+package memstorage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/denistakeda/alerting/internal/auth"
+)
+
+// SaveToken stores a new token.
+func (m *Memstorage) SaveToken(_ context.Context, token *auth.Token) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.tokens[token.Hash] = token
+	return nil
+}
+
+// TokenByHash returns a token by the hash of its secret.
+func (m *Memstorage) TokenByHash(_ context.Context, hash string) (*auth.Token, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	token, ok := m.tokens[hash]
+	return token, ok
+}
+
+// Tokens returns all the tokens ordered by creation time.
+func (m *Memstorage) Tokens(_ context.Context) ([]*auth.Token, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	res := make([]*auth.Token, 0, len(m.tokens))
+	for _, token := range m.tokens {
+		res = append(res, token)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+
+	return res, nil
+}
+
+// RevokeToken deletes a token, auth.ErrTokenNotFound is returned if it does not exist.
+func (m *Memstorage) RevokeToken(_ context.Context, id string) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for hash, token := range m.tokens {
+		if token.ID == id {
+			delete(m.tokens, hash)
+			return nil
+		}
+	}
+	return auth.ErrTokenNotFound
+}
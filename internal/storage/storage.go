@@ -2,10 +2,57 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/pkg/errors"
+
+	"github.com/denistakeda/alerting/internal/audit"
+	"github.com/denistakeda/alerting/internal/auth"
 	"github.com/denistakeda/alerting/internal/metric"
 )
 
+// ErrSeriesLimit is returned if new series were rejected because of the cardinality limits.
+var ErrSeriesLimit = errors.New("series limit exceeded")
+
+// Series identifies the metrics of the same type and name.
+type Series struct {
+	Type metric.Type `json:"type"`
+	ID   string      `json:"id"`
+}
+
+func (s Series) String() string {
+	return string(s.Type) + ":" + s.ID
+}
+
+// SeriesLimitError lists the rejected series, the other metrics were stored.
+type SeriesLimitError struct {
+	Rejected []Series
+}
+
+// maxListedSeries is the number of rejected series named in the error message.
+const maxListedSeries = 10
+
+func (e *SeriesLimitError) Error() string {
+	listed := make([]string, 0, maxListedSeries)
+	for _, series := range e.Rejected {
+		if len(listed) == maxListedSeries {
+			break
+		}
+		listed = append(listed, series.String())
+	}
+	msg := fmt.Sprintf("%v, rejected %d new series: %s", ErrSeriesLimit, len(e.Rejected), strings.Join(listed, ", "))
+	if len(e.Rejected) > len(listed) {
+		msg += ", ..."
+	}
+	return msg
+}
+
+// Is makes the error match ErrSeriesLimit.
+func (e *SeriesLimitError) Is(target error) bool {
+	return target == ErrSeriesLimit
+}
+
 type Storage interface {
 	// Get returns a metric if exists.
 	Get(ctx context.Context, metricType metric.Type, metricName string) (*metric.Metric, bool)
@@ -20,3 +67,23 @@ type Storage interface {
 	// Ping pings the database.
 	Ping(ctx context.Context) error
 }
+
+// TokenStorage keeps the API tokens.
+type TokenStorage interface {
+	// SaveToken stores a new token.
+	SaveToken(ctx context.Context, token *auth.Token) error
+	// TokenByHash returns a token by the hash of its secret.
+	TokenByHash(ctx context.Context, hash string) (*auth.Token, bool)
+	// Tokens returns all the tokens.
+	Tokens(ctx context.Context) ([]*auth.Token, error)
+	// RevokeToken deletes a token, auth.ErrTokenNotFound is returned if it does not exist.
+	RevokeToken(ctx context.Context, id string) error
+}
+
+// AuditStorage keeps the audit log, the entries are never modified or deleted.
+type AuditStorage interface {
+	// AppendAudit adds an entry and assigns its ID.
+	AppendAudit(ctx context.Context, entry *audit.Entry) error
+	// AuditEntries returns the newest entries selected by the filter.
+	AuditEntries(ctx context.Context, filter audit.Filter) ([]*audit.Entry, error)
+}
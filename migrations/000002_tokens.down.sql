@@ -0,0 +1 @@
+DROP TABLE tokens;
\ No newline at end of file
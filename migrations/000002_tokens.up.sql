@@ -0,0 +1,7 @@
+CREATE TABLE tokens (
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
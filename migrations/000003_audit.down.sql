@@ -0,0 +1 @@
+DROP TABLE audit;
\ No newline at end of file
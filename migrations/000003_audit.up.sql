@@ -0,0 +1,16 @@
+CREATE TABLE audit (
+    id BIGSERIAL PRIMARY KEY,
+    time TIMESTAMPTZ NOT NULL,
+    actor VARCHAR(32) NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    action VARCHAR(256) NOT NULL,
+    target VARCHAR(256) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    details TEXT NOT NULL
+);
+
+CREATE INDEX audit_time_idx ON audit (time);
+
+-- The audit log is append-only
+CREATE RULE audit_no_update AS ON UPDATE TO audit DO INSTEAD NOTHING;
+CREATE RULE audit_no_delete AS ON DELETE TO audit DO INSTEAD NOTHING;
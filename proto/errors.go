@@ -0,0 +1,6 @@
+package proto
+
+// SeriesLimitViolation is the type of the PreconditionFailure violations in the
+// status of UpdateMetrics, one per series rejected by the cardinality limits of
+// the server. The subject of a violation is the series as "<type>:<id>".
+const SeriesLimitViolation = "SERIES_LIMIT"